@@ -0,0 +1,276 @@
+// File deduplication
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Sub-command mapping table.
+//
+// The first command line argument is command name,
+// if it's not found, then default command (remove
+// duplicated files) will run.
+var commandMapping = map[string]func(args []string) int{
+	"manifest":         mainManifest,
+	"compare-manifest": mainCompareManifest,
+	"find":             mainFind,
+	"unique":           mainUnique,
+	"ingest":           mainIngest,
+	"merge":            mainMerge,
+	"verify":           mainVerify,
+}
+
+// Command line options for scanning files,
+// which are shared by all commands.
+type scanOptions struct {
+	verbose  bool
+	includes string
+	excludes string
+	xattr    string
+	sniff    bool
+
+	// Honor ".gitignore" files as well as ".dedupignore".
+	gitignore bool
+
+	// Path filters, globs are separated by ",".
+	excludeGlobs string
+	excludeRegex string
+	includeGlobs string
+	includeRegex string
+}
+
+// Parse command line options, default values
+// are set by config file ($HOME/.dedup/config).
+//
+// "command" is "" for the main command.
+// Error messages have been printed if an error is returned.
+func parseFlags(flags *flag.FlagSet, command string, args []string) error {
+	config, err := LoadConfig(filepath.Join(GetDedupDir(), CONFIG_FILE_NAME))
+	if err == nil {
+		if err = config.ApplyTypes(); err == nil {
+			err = config.ApplyFlags(flags, command)
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return err
+	}
+
+	return flags.Parse(args)
+}
+
+// Register scan options to a flag set.
+func (me *scanOptions) addFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&me.verbose, "v", false, "Verbose mode.")
+	flags.StringVar(&me.includes, "i", "", "Include filters.")
+	flags.StringVar(&me.excludes, "e", "", "Exclude filters.")
+	flags.StringVar(&me.xattr, "xattr", "", "Save file hashes in extended attributes.")
+	flags.BoolVar(&me.sniff, "sniff", false, "Detect types of files by content, instead of extensions.")
+	flags.BoolVar(&me.gitignore, "gitignore", false, "Honor .gitignore files as well as .dedupignore.")
+	flags.StringVar(&me.excludeGlobs, "x", "", "Exclude files and folders matching glob patterns.")
+	flags.StringVar(&me.excludeRegex, "xr", "", "Exclude files and folders matching a regular expression.")
+	flags.StringVar(&me.includeGlobs, "ix", "", "Include files matching glob patterns.")
+	flags.StringVar(&me.includeRegex, "ixr", "", "Include files matching a regular expression.")
+}
+
+// Create a file scanner and scan input paths.
+//
+// Error messages have been printed if an error is returned.
+func (me *scanOptions) scan(args []string) (FileScanner, Updater, error) {
+	scanner, updater, err := me.newScanner(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Scan files.
+	if err := scanner.Scan(); err != nil {
+		return nil, nil, err
+	}
+
+	return scanner, updater, nil
+}
+
+// Add path filters (-x, -xr, -ix, -ixr) to filter object.
+func (me *scanOptions) addPathFilters(filter Filter) error {
+	for _, exclude := range []bool{true, false} {
+		globs, regex := me.includeGlobs, me.includeRegex
+		if exclude {
+			globs, regex = me.excludeGlobs, me.excludeRegex
+		}
+
+		if len(globs) > 0 {
+			for _, glob := range strings.Split(globs, ",") {
+				if err := filter.AddPathFilter(glob, false, exclude); err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(regex) > 0 {
+			if err := filter.AddPathFilter(regex, true, exclude); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Create filter object with type filters and path filters.
+//
+// Error messages have been printed if an error is returned.
+func (me *scanOptions) newFilter() (Filter, error) {
+	filter, err := NewFilter(me.includes, me.excludes, me.sniff)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+
+	// Path filters.
+	if err := me.addPathFilters(filter); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// Create a file scanner for input paths, but do not scan them.
+//
+// Error messages have been printed if an error is returned.
+func (me *scanOptions) newScanner(args []string) (FileScanner, Updater, error) {
+	// Create filter object.
+	filter, err := me.newFilter()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Extended attribute mode.
+	xattrMode, err := ParseXattrMode(me.xattr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return nil, nil, err
+	}
+
+	// Convert input paths to absolute.
+	paths, err := getAbsUniquePaths(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Create status updater.
+	updater := NewUpdater(me.verbose)
+
+	// Create file scanner.
+	scanner := NewFileScanner(paths, filter, updater, xattrMode)
+
+	if me.gitignore {
+		scanner.SetIgnoreFiles([]string{IGNORE_FILE_NAME, GIT_IGNORE_FILE_NAME})
+	}
+
+	// Ignore error because cache is not very important.
+	scanner.ReadCache()
+
+	return scanner, updater, nil
+}
+
+// Return value is PROMPT_ANSWER_???
+//
+// PROMPT_ANSWER_YES means that the file could be removed.
+func promptRemove(file *FileAttr) int {
+
+	// Create a buffered reader.
+	reader := bufio.NewReader(os.Stdin)
+
+	for {
+		fmt.Printf("Do you want to remove %v? (Yes,Skip,Continue,Quit):", file.Path)
+		if line, _, err := reader.ReadLine(); err == nil {
+			switch strings.ToLower(string(line)) {
+			case "y", "yes":
+				return PROMPT_ANSWER_YES
+
+			case "s", "skip":
+				return PROMPT_ANSWER_SKIP
+
+			case "c", "continue":
+				return PROMPT_ANSWER_CONTINUE
+
+			case "q", "quit":
+				return PROMPT_ANSWER_QUIT
+
+			case "":
+				fmt.Println()
+
+			default:
+				fmt.Fprintf(os.Stderr, "Invalid Command: %v\n\n", string(line))
+			}
+		}
+	}
+}
+
+// Remove a file and update cache.
+//
+// Return true if the file was removed.
+func removeFile(file *FileAttr, scanner FileScanner, updater Updater) bool {
+	if err := os.Remove(file.Path); err != nil {
+		updater.IncreaseErrors()
+		updater.Log(LOG_ERROR, "Could not delete file %v (%v).", file.Path, err)
+		return false
+	}
+
+	// Write log and update cache file.
+	updater.Log(LOG_INFO, "%v was deleted.", file.Path)
+	scanner.OnFileRemoved(file)
+
+	return true
+}
+
+// Print summary of scanned files.
+func logScanSummary(scanner FileScanner, updater Updater) {
+	updater.Log(LOG_INFO, "<Summary>")
+	updater.Log(LOG_INFO, "Total Files:      %v", scanner.GetTotalFiles())
+	updater.Log(LOG_INFO, "Total Folders:    %v", scanner.GetTotalFolders())
+	updater.Log(LOG_INFO, "Total Size:       %.3f MB", float64(scanner.GetTotalBytes())/(1024*1024))
+}
+
+// Get all scanned files, sorted by path.
+func getSortedScannedFiles(scanner FileScanner) []*FileAttr {
+	files := make([]*FileAttr, 0, scanner.GetTotalFiles())
+
+	for _, item := range scanner.GetScannedFiles() {
+		files = append(files, item...)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files
+}
+
+// Get device and inode numbers of scanned files under a folder,
+// but not under "exclude" ("" means nothing is excluded).
+//
+// It's used to find hard links, files without
+// device and inode numbers are not included.
+func getScannedFileIds(scanner FileScanner, folder, exclude string) map[FileId]bool {
+	ids := make(map[FileId]bool)
+
+	for _, list := range scanner.GetScannedFiles() {
+		for _, file := range list {
+			if file.Id.IsValid() && SameOrIsChild(folder, file.Path) &&
+				(len(exclude) == 0 || !SameOrIsChild(exclude, file.Path)) {
+				ids[file.Id] = true
+			}
+		}
+	}
+
+	return ids
+}
@@ -0,0 +1,53 @@
+// File deduplication
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// Size of buffers for comparing file content.
+const COMPARE_BUFFER_SIZE = 512 * 1024
+
+// Compare content of two files byte by byte.
+//
+// Saved hashes are not used at all, so it's
+// slow but does not trust stale cache.
+func SameContent(path1, path2 string) (bool, error) {
+	fp1, err := os.Open(path1)
+	if err != nil {
+		return false, err
+	}
+	defer fp1.Close()
+
+	fp2, err := os.Open(path2)
+	if err != nil {
+		return false, err
+	}
+	defer fp2.Close()
+
+	buffer1 := make([]byte, COMPARE_BUFFER_SIZE)
+	buffer2 := make([]byte, COMPARE_BUFFER_SIZE)
+
+	for {
+		n1, err1 := io.ReadFull(fp1, buffer1)
+		if err1 != nil && err1 != io.EOF && err1 != io.ErrUnexpectedEOF {
+			return false, err1
+		}
+
+		n2, err2 := io.ReadFull(fp2, buffer2)
+		if err2 != nil && err2 != io.EOF && err2 != io.ErrUnexpectedEOF {
+			return false, err2
+		}
+
+		if n1 != n2 || !bytes.Equal(buffer1[0:n1], buffer2[0:n2]) {
+			return false, nil
+		}
+
+		// Reaching end of both files.
+		if err1 != nil {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// File deduplication
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// Config file name, it's in dedup directory ($HOME/.dedup).
+const CONFIG_FILE_NAME = "config"
+
+// Config file, e.g.
+//
+//	# File types, "=" defines a type and "+=" extends it.
+//	[types]
+//	raw = .cr2,.nef,.arw
+//	photo += .jxl
+//
+//	# Default flags of all commands.
+//	[flags]
+//	sniff = true
+//	xattr = on
+//
+//	# Default flags of a command.
+//	[flags.verify]
+//	heal = true
+type Config struct {
+	path    string
+	entries []*configEntry
+}
+
+// Register flags of each command to a flag set, "" is the
+// main command. It's used to report unknown flags in config file.
+var commandFlags = map[string]func(flags *flag.FlagSet){
+	"":                 (&mainOptions{}).addFlags,
+	"manifest":         (&manifestOptions{}).addFlags,
+	"compare-manifest": (&compareManifestOptions{}).addFlags,
+	"find":             (&scanOptions{}).addFlags,
+	"unique":           (&uniqueOptions{}).addFlags,
+	"ingest":           (&ingestOptions{}).addFlags,
+	"merge":            (&mergeOptions{}).addFlags,
+	"verify":           (&verifyOptions{}).addFlags,
+}
+
+// Check if a flag belongs to any command.
+func isKnownFlag(name string) bool {
+	for command, addFlags := range commandFlags {
+		flags := flag.NewFlagSet(command, flag.ContinueOnError)
+		addFlags(flags)
+
+		if flags.Lookup(name) != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Config entry, "name = value" or "name += value".
+type configEntry struct {
+	section string
+	name    string
+	value   string
+	extend  bool
+	line    int
+}
+
+// Get dedup directory ($HOME/.dedup).
+func GetDedupDir() string {
+	current, err := user.Current()
+	if err != nil {
+		panic(err)
+	}
+
+	return filepath.Join(current.HomeDir, ".dedup")
+}
+
+// Load config file, if it does not exist, then an empty config is returned.
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{path: path}
+
+	fp, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+
+		return nil, err
+	}
+	defer fp.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(fp)
+
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines and comments.
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		// Section, e.g. "[types]".
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, config.fail(number, "invalid section %v", line)
+			}
+
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			if section != "types" && section != "flags" && !strings.HasPrefix(section, "flags.") {
+				return nil, config.fail(number, "unknown section [%v]", section)
+			}
+
+			if command := strings.TrimPrefix(section, "flags."); command != section {
+				if _, ok := commandFlags[command]; !ok || len(command) == 0 {
+					return nil, config.fail(number, "unknown command %v of section [%v]", command, section)
+				}
+			}
+
+			continue
+		}
+
+		index := strings.IndexByte(line, '=')
+		if index <= 0 || len(section) == 0 {
+			return nil, config.fail(number, "\"name = value\" in a section is expected")
+		}
+
+		entry := &configEntry{
+			section: section,
+			name:    strings.ToLower(strings.TrimSpace(line[0:index])),
+			value:   strings.TrimSpace(line[index+1:]),
+			line:    number,
+		}
+
+		if strings.HasSuffix(entry.name, "+") {
+			entry.name = strings.TrimSpace(entry.name[0 : len(entry.name)-1])
+			entry.extend = true
+		}
+
+		if len(entry.name) == 0 {
+			return nil, config.fail(number, "name is missing")
+		}
+
+		config.entries = append(config.entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (me *Config) fail(line int, format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid config file %v (line %v): %v.", me.path, line, fmt.Sprintf(format, args...))
+}
+
+// Define or extend file types, see section "[types]".
+func (me *Config) ApplyTypes() error {
+	for _, entry := range me.entries {
+		if entry.section != "types" {
+			continue
+		}
+
+		exts := make([]string, 0, 8)
+		for _, ext := range strings.Split(strings.ToLower(entry.value), ",") {
+			ext = strings.TrimSpace(ext)
+			if len(ext) < 2 || ext[0] != '.' || strings.ContainsAny(ext, " /\\") {
+				return me.fail(entry.line, "invalid extention %q of type %v", ext, entry.name)
+			}
+
+			exts = append(exts, ext)
+		}
+
+		if entry.extend {
+			if _, ok := extentionMapping[entry.name]; !ok {
+				return me.fail(entry.line, "type %v to extend does not exist", entry.name)
+			}
+
+			extentionMapping[entry.name] = append(extentionMapping[entry.name], exts...)
+		} else {
+			extentionMapping[entry.name] = exts
+		}
+
+		for _, ext := range exts {
+			knownExtentions[ext] = true
+		}
+	}
+
+	return nil
+}
+
+// Set default flags, see sections "[flags]" and "[flags.<COMMAND>]".
+//
+// Flags of section "[flags]" are shared by all commands,
+// so they are ignored if a command does not have them,
+// but flags of no command are reported.
+// "command" is "" for the main command.
+func (me *Config) ApplyFlags(flags *flag.FlagSet, command string) error {
+	for _, entry := range me.entries {
+		if entry.section == "flags" {
+			if flags.Lookup(entry.name) == nil {
+				if !isKnownFlag(entry.name) {
+					return me.fail(entry.line, "unknown flag -%v", entry.name)
+				}
+
+				continue
+			}
+		} else if entry.section != "flags."+command {
+			continue
+		}
+
+		if entry.extend {
+			return me.fail(entry.line, "\"+=\" is not supported by flags")
+		}
+
+		if flags.Lookup(entry.name) == nil {
+			return me.fail(entry.line, "unknown flag -%v of command %v", entry.name, command)
+		}
+
+		if err := flags.Set(entry.name, entry.value); err != nil {
+			return me.fail(entry.line, "invalid value of flag -%v (%v)", entry.name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,33 @@
+// File deduplication
+package main
+
+import (
+	"testing"
+)
+
+func TestCommandFlags(t *testing.T) {
+	for command := range commandMapping {
+		if _, ok := commandFlags[command]; !ok {
+			t.Errorf("flags of command %v are not registered", command)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		known bool
+	}{
+		{"v", true},
+		{"sniff", true},
+		{"paranoid", true},
+		{"heal", true},
+		{"o", true},
+		{"t", true},
+		{"unknown", false},
+	}
+
+	for _, test := range tests {
+		if known := isKnownFlag(test.name); known != test.known {
+			t.Errorf("isKnownFlag(%q) = %v, want %v", test.name, known, test.known)
+		}
+	}
+}
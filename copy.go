@@ -0,0 +1,123 @@
+// File deduplication
+package main
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Copy a file to a new path.
+//
+// Parent folders of target path are created if they do not exist,
+// and last modification time is preserved. If target file already
+// exists, then an error is returned and the target is not changed.
+func CopyFile(source, target string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(target)
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		os.Remove(target)
+		return err
+	}
+
+	return os.Chtimes(target, time.Now(), info.ModTime())
+}
+
+// Get a path that does not exist yet.
+//
+// If the input path already exists (or it's reserved), then a number
+// is appended to file name, e.g. "/aa/bb.jpg" -> "/aa/bb-1.jpg".
+// Keys of map "reserved" are returned by GetPathAsKey(), it could be null.
+func GetUnusedPath(path string, reserved map[string]bool) string {
+	ext := filepath.Ext(path)
+	base := path[0 : len(path)-len(ext)]
+
+	for i := 1; ; i++ {
+		if !reserved[GetPathAsKey(path)] {
+			if _, err := os.Lstat(path); os.IsNotExist(err) {
+				return path
+			}
+		}
+
+		path = base + "-" + strconv.Itoa(i) + ext
+	}
+}
+
+// Move a file to a new path.
+//
+// Parent folders of target path are created if they do not exist.
+// If the file could not be renamed (e.g. target path is on another
+// device), then it's copied and the source file is removed.
+func MoveFile(source, target string) error {
+	if _, err := os.Lstat(target); err == nil {
+		return os.ErrExist
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+
+	if err := os.Rename(source, target); err == nil {
+		return nil
+	}
+
+	if err := CopyFile(source, target); err != nil {
+		return err
+	}
+
+	return os.Remove(source)
+}
+
+// Remove empty folders, including the root folder itself.
+//
+// Return number of removed folders.
+func RemoveEmptyFolders(root string) int {
+	folders := make([]string, 0, 64)
+
+	filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.IsDir() {
+			folders = append(folders, path)
+		}
+
+		return nil
+	})
+
+	// Sub-folders are always after their parent folders,
+	// so remove them in reverse order. Folders that are
+	// not empty could not be removed.
+	count := 0
+	for i := len(folders) - 1; i >= 0; i-- {
+		if os.Remove(folders[i]) == nil {
+			count++
+		}
+	}
+
+	return count
+}
@@ -10,4 +10,13 @@ var (
 	ErrInvalidCacheFile     = errors.New("Invalid cache file format.")
 	ErrRootPathNotPermitted = errors.New("Root path \"/\" is not permitted.")
 	ErrInvalidFilters       = errors.New("Invalid include (or exclude) filters.")
+	ErrInvalidPathFilters   = errors.New("Invalid path filters (-x, -xr, -ix, -ixr).")
+	ErrInvalidXattrMode     = errors.New("Invalid extended attribute mode (-xattr <MODE>).")
+	ErrXattrNotSupported    = errors.New("Extended attributes are not supported.")
+	ErrInvalidManifestFile  = errors.New("Invalid manifest file format.")
+	ErrInvalidTemplate      = errors.New("Invalid template argument (-t <TEMPLATE>).")
+	ErrOverlappedPaths      = errors.New("Source and target paths must not overlap.")
+	ErrInvalidGroupOrder    = errors.New("Invalid sort order argument (-sort <ORDER>).")
+	ErrInvalidKeepCount     = errors.New("Invalid number of files to keep (-keep <N>).")
+	ErrInvalidKeepDistinct  = errors.New("Invalid distinct argument (-distinct <WHAT>).")
 )
@@ -0,0 +1,252 @@
+// File deduplication
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Prefix of external policy, e.g. "exec:/path/to/script".
+const EXEC_POLICY_PREFIX = "exec:"
+
+// Maximum time of external program to decide a group.
+const EXEC_POLICY_TIMEOUT = 30 * time.Second
+
+// File of a duplicated group sent to external program.
+type execPolicyFile struct {
+	Index    int    `json:"index"`
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+	Root     int    `json:"root"`
+	Depth    int    `json:"depth"`
+	ModTime  string `json:"mtime"`
+	Uid      uint32 `json:"uid"`
+	Gid      uint32 `json:"gid"`
+	Links    uint64 `json:"links"`
+	Writable bool   `json:"writable"`
+}
+
+// Duplicated group sent to external program.
+type execPolicyGroup struct {
+	SHA256 string            `json:"sha256"`
+	Size   int64             `json:"size"`
+	Files  []*execPolicyFile `json:"files"`
+}
+
+// External policy.
+//
+// Each duplicated group is sent to the program as JSON on stdin,
+// and the program writes back on stdout either:
+//
+// 1) Index of the file to keep, e.g. "2".
+// 2) Decision of each file, e.g. ["keep","delete","keep"].
+//
+// Indexes start from 0. If the program fails, times out or its
+// answer is invalid, then all files of the group are kept.
+type execPolicyImpl struct {
+	command string // Program and arguments of policy spec.
+	program string
+	args    []string
+
+	// Files decided to keep (true) or delete (false) by the program.
+	// Files kept by index only are not in the map.
+	decisions map[*FileAttr]bool
+
+	// Files of groups which could not be decided.
+	failures map[*FileAttr]bool
+}
+
+// Create an external policy, spec is "exec:<PROGRAM> [<ARG>...]".
+//
+// Arguments are separated by spaces, e.g. "exec:python3 policy.py".
+// If the whole command is an executable, then it has no arguments,
+// so program paths with spaces work as well.
+func newExecPolicy(spec string) (Policy, error) {
+	command := strings.TrimSpace(spec[len(EXEC_POLICY_PREFIX):])
+	if len(command) == 0 {
+		return nil, ErrInvalidPolicy
+	}
+
+	var args []string
+	path, err := exec.LookPath(command)
+	if err != nil {
+		fields := strings.Fields(command)
+		if path, err = exec.LookPath(fields[0]); err != nil {
+			return nil, err
+		}
+
+		args = fields[1:]
+	}
+
+	return &execPolicyImpl{
+		command:   command,
+		program:   path,
+		args:      args,
+		decisions: make(map[*FileAttr]bool),
+		failures:  make(map[*FileAttr]bool),
+	}, nil
+}
+
+// Run external program and return decision of each file.
+//
+// The second return value is false if the program
+// returned index of the file to keep only.
+func (me *execPolicyImpl) run(files []*FileAttr) ([]bool, bool, error) {
+	group := &execPolicyGroup{
+		SHA256: files[0].SHA256.String(),
+		Size:   files[0].Size,
+		Files:  make([]*execPolicyFile, 0, len(files)),
+	}
+
+	for i, file := range files {
+		group.Files = append(group.Files, &execPolicyFile{
+			Index:    i,
+			Path:     file.Path,
+			Name:     file.Name,
+			Root:     file.Root + 1,
+			Depth:    file.GetDepth(),
+			ModTime:  time.Unix(0, file.ModTime).Format(time.RFC3339Nano),
+			Uid:      file.Uid,
+			Gid:      file.Gid,
+			Links:    file.Links,
+			Writable: file.IsWritable(),
+		})
+	}
+
+	input, err := json.Marshal(group)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Do not wait forever if the program hangs.
+	ctx, cancel := context.WithTimeout(context.Background(), EXEC_POLICY_TIMEOUT)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, me.program, me.args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+	cmd.WaitDelay = time.Second
+
+	output, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, false, fmt.Errorf("timed out after %v", EXEC_POLICY_TIMEOUT)
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return parseExecPolicyAnswer(output, len(files))
+}
+
+// Parse answer of external program, see execPolicyImpl.
+func parseExecPolicyAnswer(output []byte, count int) ([]bool, bool, error) {
+	invalid := fmt.Errorf("invalid answer %q", strings.TrimSpace(string(output)))
+	keep := make([]bool, count)
+
+	var index int
+	if err := json.Unmarshal(output, &index); err == nil {
+		if index < 0 || index >= count {
+			return nil, false, invalid
+		}
+
+		keep[index] = true
+		return keep, false, nil
+	}
+
+	var answers []string
+	if err := json.Unmarshal(output, &answers); err != nil || len(answers) != count {
+		return nil, false, invalid
+	}
+
+	kept := 0
+	for i, answer := range answers {
+		switch strings.ToLower(answer) {
+		case "keep":
+			keep[i] = true
+			kept++
+
+		case "delete":
+
+		default:
+			return nil, false, invalid
+		}
+	}
+
+	// Never delete all copies.
+	if kept == 0 {
+		return nil, false, invalid
+	}
+
+	return keep, true, nil
+}
+
+// Files to keep come first, otherwise the order is not changed.
+func (me *execPolicyImpl) Sort(files []*FileAttr) {
+	keep, perFile, err := me.run(files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Policy program %v failed on %v (%v), keep all files.\n",
+			me.command, files[0].Path, err)
+
+		for _, file := range files {
+			me.failures[file] = true
+		}
+
+		return
+	}
+
+	decisions := make(map[*FileAttr]bool)
+	for i, file := range files {
+		decisions[file] = keep[i]
+
+		if perFile {
+			me.decisions[file] = keep[i]
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return decisions[files[i]] && !decisions[files[j]]
+	})
+}
+
+func (me *execPolicyImpl) GetKeepCount(files []*FileAttr) int {
+	if me.failures[files[0]] {
+		return len(files)
+	}
+
+	count := 0
+	for _, file := range files {
+		if !me.decisions[file] {
+			break
+		}
+
+		count++
+	}
+
+	return count
+}
+
+func (me *execPolicyImpl) Explain(files []*FileAttr) []string {
+	lines := make([]string, 0, len(files))
+
+	for i := 1; i < len(files); i++ {
+		_, decided := me.decisions[files[i]]
+
+		if me.failures[files[i]] {
+			lines = append(lines, fmt.Sprintf("%v) over %v): policy program failed, keep all files", i, i+1))
+		} else if i > 1 && !decided {
+			// Only index of the file to keep was returned.
+			lines = append(lines, fmt.Sprintf("%v) over %v): not decided by policy program, smaller path ranked first", i, i+1))
+		} else {
+			lines = append(lines, fmt.Sprintf("%v) over %v): decided by \"%v%v\"",
+				i, i+1, EXEC_POLICY_PREFIX, me.command))
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,589 @@
+// File deduplication
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy expression, e.g.
+// 'prefer(path =~ "^/archive/") then older(mtime) then shorter(name)'.
+//
+// An expression is a list of clauses separated by "then",
+// which are evaluated in order like policy items:
+//
+// 1) "prefer(<COND>)": Keep files matching the condition.
+// 2) "avoid(<COND>)": Keep files not matching the condition.
+// 3) "older(<TIME>)", "newer(<TIME>)": Keep older (or newer) files.
+// 4) "shorter(<TEXT>)", "longer(<TEXT>)": Keep shorter (or longer) text.
+// 5) "smaller(<NUMBER>)", "larger(<NUMBER>)": Keep smaller (or larger) numbers.
+//
+// Conditions compare fields with literals, e.g. 'name =~ "(?i)^img_"',
+// 'size >= 10m', 'mtime < "2020-01-01"', and could be combined
+// with "and", "or", "not" and parentheses.
+
+const (
+	// Text fields, e.g. path, name.
+	EXPR_FIELD_TEXT = iota
+
+	// Number fields, e.g. size, depth.
+	EXPR_FIELD_NUMBER
+
+	// Time fields in nanoseconds, e.g. mtime.
+	EXPR_FIELD_TIME
+
+	// Boolean fields, e.g. writable.
+	EXPR_FIELD_BOOL
+)
+
+// Field of policy expression.
+type exprField struct {
+	kind int
+
+	// Value of text fields.
+	text func(file *FileAttr) string
+
+	// Value of number, time and boolean fields (0 or 1).
+	number func(file *FileAttr) int64
+}
+
+// Field mapping table.
+var exprFieldMapping = map[string]*exprField{
+	"path": &exprField{kind: EXPR_FIELD_TEXT,
+		text: func(file *FileAttr) string { return filepath.ToSlash(file.Path) }},
+	"dir": &exprField{kind: EXPR_FIELD_TEXT,
+		text: func(file *FileAttr) string { return filepath.ToSlash(filepath.Dir(file.Path)) }},
+	"name": &exprField{kind: EXPR_FIELD_TEXT,
+		text: func(file *FileAttr) string { return file.Name }},
+	"ext": &exprField{kind: EXPR_FIELD_TEXT,
+		text: func(file *FileAttr) string { return strings.ToLower(filepath.Ext(file.Name)) }},
+	"size": &exprField{kind: EXPR_FIELD_NUMBER,
+		number: func(file *FileAttr) int64 { return file.Size }},
+	"depth": &exprField{kind: EXPR_FIELD_NUMBER,
+		number: func(file *FileAttr) int64 { return int64(file.GetDepth()) }},
+	"root": &exprField{kind: EXPR_FIELD_NUMBER,
+		number: func(file *FileAttr) int64 { return int64(file.Root + 1) }},
+	"links": &exprField{kind: EXPR_FIELD_NUMBER,
+		number: func(file *FileAttr) int64 { return int64(file.Links) }},
+	"uid": &exprField{kind: EXPR_FIELD_NUMBER,
+		number: func(file *FileAttr) int64 { return int64(file.Uid) }},
+	"gid": &exprField{kind: EXPR_FIELD_NUMBER,
+		number: func(file *FileAttr) int64 { return int64(file.Gid) }},
+	"mtime": &exprField{kind: EXPR_FIELD_TIME,
+		number: func(file *FileAttr) int64 { return file.ModTime }},
+	"ctime": &exprField{kind: EXPR_FIELD_TIME,
+		number: func(file *FileAttr) int64 { return file.ChangeTime }},
+	"btime": &exprField{kind: EXPR_FIELD_TIME,
+		number: func(file *FileAttr) int64 { return file.GetBirthTime() }},
+	"writable": &exprField{kind: EXPR_FIELD_BOOL,
+		number: func(file *FileAttr) int64 { return boolToInt64(file.IsWritable()) }},
+}
+
+// Names of field kinds, used by error messages.
+var exprFieldKindNames = map[int]string{
+	EXPR_FIELD_TEXT:   "text field (path, dir, name, ext)",
+	EXPR_FIELD_NUMBER: "number field (size, depth, root, links, uid, gid)",
+	EXPR_FIELD_TIME:   "time field (mtime, ctime, btime)",
+	EXPR_FIELD_BOOL:   "boolean field (writable)",
+}
+
+// Clause of policy expression.
+type exprClause struct {
+	// Condition of "prefer" and "avoid".
+	cond func(file *FileAttr) bool
+
+	// Field of ordering clauses, e.g. "older".
+	field *exprField
+}
+
+// Get the value compared by this clause.
+func (me *exprClause) getValue(file *FileAttr) int64 {
+	if me.cond != nil {
+		return boolToInt64(me.cond(file))
+	}
+
+	if me.field.kind == EXPR_FIELD_TEXT {
+		return int64(len(me.field.text(file)))
+	}
+
+	return me.field.number(file)
+}
+
+// Describe the value compared by this clause.
+func (me *exprClause) describe(file *FileAttr) string {
+	if me.cond != nil {
+		if me.cond(file) {
+			return "matched"
+		}
+
+		return "not matched"
+	}
+
+	switch me.field.kind {
+	case EXPR_FIELD_TEXT:
+		return fmt.Sprintf("length %v", len(me.field.text(file)))
+
+	case EXPR_FIELD_TIME:
+		return describeTime(me.field.number(file))
+	}
+
+	return strconv.FormatInt(me.field.number(file), 10)
+}
+
+// Clause mapping table, value of policy item and field kind
+// (-1 means conditions of "prefer" and "avoid").
+var exprClauseMapping = map[string]struct{ value, kind int }{
+	"prefer":  {-1, -1},
+	"avoid":   {1, -1},
+	"older":   {1, EXPR_FIELD_TIME},
+	"newer":   {-1, EXPR_FIELD_TIME},
+	"shorter": {1, EXPR_FIELD_TEXT},
+	"longer":  {-1, EXPR_FIELD_TEXT},
+	"smaller": {1, EXPR_FIELD_NUMBER},
+	"larger":  {-1, EXPR_FIELD_NUMBER},
+}
+
+// Policy expression syntax error.
+type PolicyError struct {
+	Expr   string
+	Offset int
+	Reason string
+}
+
+func (me *PolicyError) Error() string {
+	return fmt.Sprintf("Invalid policy expression (column %v): %v.\n    %v\n    %v^",
+		me.Offset+1, me.Reason, me.Expr, strings.Repeat(" ", me.Offset))
+}
+
+const (
+	EXPR_TOKEN_END = iota
+	EXPR_TOKEN_IDENT
+	EXPR_TOKEN_NUMBER
+	EXPR_TOKEN_STRING
+	EXPR_TOKEN_OPERATOR
+)
+
+// Token of policy expression.
+type exprToken struct {
+	kind   int
+	text   string
+	offset int
+}
+
+// Operators, longer ones come first.
+var exprOperators = []string{"==", "!=", "<=", ">=", "=~", "!~", "<", ">", "(", ")"}
+
+// Check if the spec is a policy expression rather than policy items,
+// i.e. it starts with a clause, e.g. "prefer(".
+func IsPolicyExpr(spec string) bool {
+	spec = strings.TrimSpace(spec)
+	index := strings.IndexByte(spec, '(')
+
+	if index <= 0 {
+		return false
+	}
+
+	_, ok := exprClauseMapping[strings.ToLower(strings.TrimSpace(spec[0:index]))]
+	return ok
+}
+
+// Policy expression parser.
+type exprParser struct {
+	expr   string
+	tokens []*exprToken
+	pos    int
+}
+
+func (me *exprParser) fail(offset int, format string, args ...interface{}) error {
+	return &PolicyError{Expr: me.expr, Offset: offset, Reason: fmt.Sprintf(format, args...)}
+}
+
+func isIdentChar(ch byte, first bool) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') ||
+		(!first && ch >= '0' && ch <= '9')
+}
+
+// Split expression into tokens.
+func (me *exprParser) tokenize() error {
+	expr := me.expr
+
+	for i := 0; i < len(expr); {
+		ch := expr[i]
+
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+
+		case isIdentChar(ch, true):
+			start := i
+			for i < len(expr) && isIdentChar(expr[i], false) {
+				i++
+			}
+			me.tokens = append(me.tokens, &exprToken{EXPR_TOKEN_IDENT, expr[start:i], start})
+
+		case ch >= '0' && ch <= '9':
+			start := i
+			for i < len(expr) && isIdentChar(expr[i], false) {
+				i++
+			}
+			me.tokens = append(me.tokens, &exprToken{EXPR_TOKEN_NUMBER, expr[start:i], start})
+
+		case ch == '"':
+			start := i
+			for i++; i < len(expr) && expr[i] != '"'; i++ {
+				if expr[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(expr) {
+				return me.fail(start, "unterminated string")
+			}
+			i++
+
+			// Only "\"" is escaped, so regular expressions
+			// could be written as is, e.g. "\.jpe?g$".
+			text := strings.ReplaceAll(expr[start+1:i-1], "\\\"", "\"")
+			me.tokens = append(me.tokens, &exprToken{EXPR_TOKEN_STRING, text, start})
+
+		default:
+			found := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(expr[i:], op) {
+					me.tokens = append(me.tokens, &exprToken{EXPR_TOKEN_OPERATOR, op, i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				return me.fail(i, "unexpected character %q", ch)
+			}
+		}
+	}
+
+	me.tokens = append(me.tokens, &exprToken{EXPR_TOKEN_END, "", len(expr)})
+	return nil
+}
+
+func (me *exprParser) peek() *exprToken {
+	return me.tokens[me.pos]
+}
+
+func (me *exprParser) next() *exprToken {
+	token := me.tokens[me.pos]
+	if token.kind != EXPR_TOKEN_END {
+		me.pos++
+	}
+
+	return token
+}
+
+// Check if next token is a keyword (or operator), and skip it if so.
+func (me *exprParser) accept(kind int, text string) bool {
+	token := me.peek()
+	if token.kind == kind && strings.EqualFold(token.text, text) {
+		me.pos++
+		return true
+	}
+
+	return false
+}
+
+func (me *exprParser) expect(text string) error {
+	if !me.accept(EXPR_TOKEN_OPERATOR, text) {
+		token := me.peek()
+		if token.kind == EXPR_TOKEN_END {
+			return me.fail(token.offset, "%q is expected but the expression ends", text)
+		}
+
+		return me.fail(token.offset, "%q is expected but found %q", text, token.text)
+	}
+
+	return nil
+}
+
+// Parse the whole expression: <CLAUSE> then <CLAUSE> ...
+func (me *exprParser) parse() ([]*policyItem, error) {
+	items := make([]*policyItem, 0, 4)
+
+	for {
+		item, err := me.parseClause()
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+
+		if token := me.peek(); token.kind == EXPR_TOKEN_END {
+			break
+		} else if !me.accept(EXPR_TOKEN_IDENT, "then") {
+			return nil, me.fail(token.offset, "\"then\" is expected but found %q", token.text)
+		}
+	}
+
+	return items, nil
+}
+
+// Parse a clause, e.g. "older(mtime)".
+func (me *exprParser) parseClause() (*policyItem, error) {
+	token := me.next()
+	clause, ok := exprClauseMapping[strings.ToLower(token.text)]
+	if token.kind != EXPR_TOKEN_IDENT || !ok {
+		return nil, me.fail(token.offset,
+			"unknown clause %q, expecting prefer, avoid, older, newer, shorter, longer, smaller or larger",
+			token.text)
+	}
+
+	if err := me.expect("("); err != nil {
+		return nil, err
+	}
+
+	item := &policyItem{category: POLICY_CATEGORY_EXPR, value: clause.value, clause: &exprClause{}}
+
+	if clause.kind < 0 {
+		cond, err := me.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		item.clause.cond = cond
+	} else {
+		fieldToken := me.peek()
+		field, err := me.parseField()
+		if err != nil {
+			return nil, err
+		}
+
+		if field.kind != clause.kind {
+			return nil, me.fail(fieldToken.offset, "%v() expects a %v",
+				strings.ToLower(token.text), exprFieldKindNames[clause.kind])
+		}
+
+		item.clause.field = field
+	}
+
+	if err := me.expect(")"); err != nil {
+		return nil, err
+	}
+
+	// Clause text is used by "-explain", e.g. "older(mtime)".
+	item.name = me.expr[token.offset : me.tokens[me.pos-1].offset+1]
+
+	return item, nil
+}
+
+func (me *exprParser) parseField() (*exprField, error) {
+	token := me.next()
+	field, ok := exprFieldMapping[strings.ToLower(token.text)]
+	if token.kind != EXPR_TOKEN_IDENT || !ok {
+		return nil, me.fail(token.offset, "unknown field %q", token.text)
+	}
+
+	return field, nil
+}
+
+// <AND> or <AND> ...
+func (me *exprParser) parseOr() (func(file *FileAttr) bool, error) {
+	left, err := me.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for me.accept(EXPR_TOKEN_IDENT, "or") {
+		right, err := me.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		first := left
+		left = func(file *FileAttr) bool { return first(file) || right(file) }
+	}
+
+	return left, nil
+}
+
+// <NOT> and <NOT> ...
+func (me *exprParser) parseAnd() (func(file *FileAttr) bool, error) {
+	left, err := me.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for me.accept(EXPR_TOKEN_IDENT, "and") {
+		right, err := me.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		first := left
+		left = func(file *FileAttr) bool { return first(file) && right(file) }
+	}
+
+	return left, nil
+}
+
+// not <NOT>, (<OR>), <FIELD> <OP> <LITERAL> or <BOOLEAN FIELD>
+func (me *exprParser) parseNot() (func(file *FileAttr) bool, error) {
+	if me.accept(EXPR_TOKEN_IDENT, "not") {
+		cond, err := me.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(file *FileAttr) bool { return !cond(file) }, nil
+	}
+
+	if me.accept(EXPR_TOKEN_OPERATOR, "(") {
+		cond, err := me.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := me.expect(")"); err != nil {
+			return nil, err
+		}
+
+		return cond, nil
+	}
+
+	return me.parseComparison()
+}
+
+func (me *exprParser) parseComparison() (func(file *FileAttr) bool, error) {
+	fieldToken := me.peek()
+	field, err := me.parseField()
+	if err != nil {
+		return nil, err
+	}
+
+	if field.kind == EXPR_FIELD_BOOL {
+		return func(file *FileAttr) bool { return field.number(file) != 0 }, nil
+	}
+
+	op := me.next()
+	if op.kind != EXPR_TOKEN_OPERATOR || op.text == "(" || op.text == ")" {
+		return nil, me.fail(op.offset, "comparison operator is expected after %q", fieldToken.text)
+	}
+
+	literal := me.next()
+
+	if field.kind == EXPR_FIELD_TEXT {
+		if literal.kind != EXPR_TOKEN_STRING {
+			return nil, me.fail(literal.offset, "string is expected, e.g. \"abc\"")
+		}
+
+		return me.compileTextComparison(field, op, literal)
+	}
+
+	var value int64
+	if field.kind == EXPR_FIELD_TIME {
+		if value, err = me.parseTime(literal); err != nil {
+			return nil, err
+		}
+	} else {
+		if value, err = me.parseNumber(literal); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.text {
+	case "==":
+		return func(file *FileAttr) bool { return field.number(file) == value }, nil
+	case "!=":
+		return func(file *FileAttr) bool { return field.number(file) != value }, nil
+	case "<":
+		return func(file *FileAttr) bool { return field.number(file) < value }, nil
+	case "<=":
+		return func(file *FileAttr) bool { return field.number(file) <= value }, nil
+	case ">":
+		return func(file *FileAttr) bool { return field.number(file) > value }, nil
+	case ">=":
+		return func(file *FileAttr) bool { return field.number(file) >= value }, nil
+	}
+
+	return nil, me.fail(op.offset, "operator %v is not supported by %q", op.text, fieldToken.text)
+}
+
+func (me *exprParser) compileTextComparison(field *exprField,
+	op *exprToken, literal *exprToken) (func(file *FileAttr) bool, error) {
+
+	value := literal.text
+
+	switch op.text {
+	case "==":
+		return func(file *FileAttr) bool { return field.text(file) == value }, nil
+
+	case "!=":
+		return func(file *FileAttr) bool { return field.text(file) != value }, nil
+
+	case "=~", "!~":
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return nil, me.fail(literal.offset, "invalid regular expression (%v)", err)
+		}
+
+		match := op.text == "=~"
+		return func(file *FileAttr) bool { return pattern.MatchString(field.text(file)) == match }, nil
+	}
+
+	return nil, me.fail(op.offset, "operator %v is not supported by text fields", op.text)
+}
+
+// Number with optional size suffix, e.g. "100", "10k", "5m", "1g".
+func (me *exprParser) parseNumber(literal *exprToken) (int64, error) {
+	if literal.kind != EXPR_TOKEN_NUMBER {
+		return 0, me.fail(literal.offset, "number is expected, e.g. 100, 10k, 5m")
+	}
+
+	text := strings.ToLower(literal.text)
+	unit := int64(1)
+
+	switch text[len(text)-1] {
+	case 'k':
+		unit = 1 << 10
+	case 'm':
+		unit = 1 << 20
+	case 'g':
+		unit = 1 << 30
+	}
+
+	if unit != 1 {
+		text = text[0 : len(text)-1]
+	}
+
+	number, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, me.fail(literal.offset, "invalid number %q", literal.text)
+	}
+
+	return number * unit, nil
+}
+
+// Local date (time), e.g. "2020-01-31", "2020-01-31 08:30:00".
+func (me *exprParser) parseTime(literal *exprToken) (int64, error) {
+	if literal.kind == EXPR_TOKEN_STRING {
+		for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05", time.RFC3339} {
+			if value, err := time.ParseInLocation(layout, literal.text, time.Local); err == nil {
+				return value.UnixNano(), nil
+			}
+		}
+	}
+
+	return 0, me.fail(literal.offset, "date is expected, e.g. \"2020-01-31\" or \"2020-01-31 08:30:00\"")
+}
+
+// Compile policy expression to policy items.
+func compilePolicyExpr(expr string) ([]*policyItem, error) {
+	parser := &exprParser{expr: expr}
+
+	if err := parser.tokenize(); err != nil {
+		return nil, err
+	}
+
+	return parser.parse()
+}
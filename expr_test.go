@@ -0,0 +1,235 @@
+// File deduplication
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Create a file for policy tests.
+func newTestFile(path string, size int64, modTime time.Time) *FileAttr {
+	path = filepath.FromSlash(path)
+
+	return &FileAttr{
+		Path:          path,
+		Name:          filepath.Base(path),
+		Size:          size,
+		ModTime:       modTime.UnixNano(),
+		Mode:          0644,
+		Links:         1,
+		birthTimeRead: true,
+	}
+}
+
+func TestIsPolicyExpr(t *testing.T) {
+	tests := []struct {
+		spec   string
+		isExpr bool
+	}{
+		{"prefer(writable)", true},
+		{"  Older (mtime)", true},
+		{"smaller(size) then newer(mtime)", true},
+		{"longname,longpath", false},
+		{"prefer=/a,/b", false},
+		{"keep:glob=**/(1)/**", false},
+		{"exec:/bin/policy", false},
+		{"(writable)", false},
+		{"unknown(size)", false},
+	}
+
+	for _, test := range tests {
+		if isExpr := IsPolicyExpr(test.spec); isExpr != test.isExpr {
+			t.Errorf("IsPolicyExpr(%q) = %v, want %v", test.spec, isExpr, test.isExpr)
+		}
+	}
+}
+
+func TestPolicyExprConditions(t *testing.T) {
+	file := newTestFile("/photos/2020/IMG_1234.JPG", 2<<20,
+		time.Date(2020, 6, 1, 12, 0, 0, 0, time.Local))
+
+	tests := []struct {
+		cond  string
+		match bool
+	}{
+		// Text fields.
+		{`name == "IMG_1234.JPG"`, true},
+		{`name != "IMG_1234.JPG"`, false},
+		{`ext == ".jpg"`, true},
+		{`dir == "/photos/2020"`, true},
+		{`path =~ "^/photos/"`, true},
+		{`path !~ "^/photos/"`, false},
+		{`name =~ "(?i)^img_\d+\.jpe?g$"`, true},
+		{`name =~ "^img_"`, false},
+
+		// Escaped quotes, other backslashes are kept as is.
+		{`name == "a\"b"`, false},
+		{`name =~ "\.JPG$"`, true},
+
+		// Numbers with size suffixes.
+		{`size == 2m`, true},
+		{`size == 2048k`, true},
+		{`size > 1m`, true},
+		{`size >= 3m`, false},
+		{`size < 1g`, true},
+		{`size <= 2097152`, true},
+		{`depth == 2`, true},
+		{`root == 1`, true},
+		{`links != 1`, false},
+
+		// Times.
+		{`mtime > "2020-01-01"`, true},
+		{`mtime < "2020-06-01 12:00:01"`, true},
+		{`mtime == "2020-06-01 12:00:00"`, true},
+		{`mtime < "2020-01-01"`, false},
+
+		// Boolean fields.
+		{`writable`, true},
+		{`not writable`, false},
+
+		// Precedence: "not" > "and" > "or".
+		{`size > 1g or name == "IMG_1234.JPG" and writable`, true},
+		{`(size > 1g or name == "IMG_1234.JPG") and not writable`, false},
+		{`not size > 1g and writable`, true},
+		{`not (size > 1g or writable)`, false},
+		{`writable and size > 1g or depth == 2`, true},
+		{`writable and (size > 1g or depth == 3)`, false},
+
+		// Keywords are case insensitive.
+		{`NAME == "IMG_1234.JPG" AND NOT Size > 1g`, true},
+	}
+
+	for _, test := range tests {
+		items, err := compilePolicyExpr("prefer(" + test.cond + ")")
+		if err != nil {
+			t.Errorf("compilePolicyExpr(%q) failed: %v", test.cond, err)
+			continue
+		}
+
+		if match := items[0].clause.cond(file); match != test.match {
+			t.Errorf("%q = %v, want %v", test.cond, match, test.match)
+		}
+	}
+}
+
+func TestPolicyExprErrors(t *testing.T) {
+	tests := []struct {
+		expr   string
+		offset int
+		reason string
+	}{
+		{"", 0, "unknown clause"},
+		{"keep(size)", 0, "unknown clause"},
+		{"older mtime", 6, "\"(\" is expected"},
+		{"older(mtime", 11, "expression ends"},
+		{"older(size)", 6, "expects a time field"},
+		{"shorter(size)", 8, "expects a text field"},
+		{"smaller(name)", 8, "expects a number field"},
+		{"older(foo)", 6, "unknown field"},
+		{"older(mtime) newer(ctime)", 13, "\"then\" is expected"},
+		{"older(mtime) then", 17, "unknown clause"},
+		{"prefer(name == 1)", 15, "string is expected"},
+		{"prefer(size == \"1\")", 15, "number is expected"},
+		{"prefer(size == 1x)", 15, "invalid number"},
+		{"prefer(mtime < 2020)", 15, "date is expected"},
+		{"prefer(mtime < \"2020/01/01\")", 15, "date is expected"},
+		{"prefer(name < \"a\")", 12, "not supported by text fields"},
+		{"prefer(name =~ \"(\")", 15, "invalid regular expression"},
+		{"prefer(name == \"a)", 15, "unterminated string"},
+		{"prefer(size)", 11, "comparison operator is expected"},
+		{"prefer((writable)", 17, "\")\" is expected"},
+		{"prefer(writable & size > 1)", 16, "unexpected character"},
+	}
+
+	for _, test := range tests {
+		_, err := compilePolicyExpr(test.expr)
+		if err == nil {
+			t.Errorf("compilePolicyExpr(%q) succeeded, want error", test.expr)
+			continue
+		}
+
+		policyErr, ok := err.(*PolicyError)
+		if !ok {
+			t.Errorf("compilePolicyExpr(%q) = %T, want *PolicyError", test.expr, err)
+			continue
+		}
+
+		if policyErr.Offset != test.offset || !strings.Contains(policyErr.Reason, test.reason) {
+			t.Errorf("compilePolicyExpr(%q) = %q at %v, want %q at %v",
+				test.expr, policyErr.Reason, policyErr.Offset, test.reason, test.offset)
+		}
+	}
+}
+
+func TestPolicyExprRanking(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+
+	old := newTestFile("/a/old.jpg", 10, now.Add(-time.Hour))
+	oldLong := newTestFile("/a/old-copy.jpg", 10, now.Add(-time.Hour))
+	recent := newTestFile("/archive/new.jpg", 10, now)
+
+	tests := []struct {
+		expr  string
+		files []*FileAttr
+		want  []*FileAttr
+	}{
+		{"older(mtime)", []*FileAttr{recent, old}, []*FileAttr{old, recent}},
+		{"newer(mtime)", []*FileAttr{old, recent}, []*FileAttr{recent, old}},
+		{"older(mtime) then shorter(name)", []*FileAttr{recent, oldLong, old},
+			[]*FileAttr{old, oldLong, recent}},
+		{"longer(name) then older(mtime)", []*FileAttr{old, recent, oldLong},
+			[]*FileAttr{oldLong, old, recent}},
+		{`prefer(path =~ "^/archive/") then older(mtime)`, []*FileAttr{old, oldLong, recent},
+			[]*FileAttr{recent, old, oldLong}},
+		{`avoid(name =~ "-copy") then newer(mtime)`, []*FileAttr{oldLong, old, recent},
+			[]*FileAttr{recent, old, oldLong}},
+	}
+
+	for _, test := range tests {
+		policy, err := NewPolicy(test.expr)
+		if err != nil {
+			t.Errorf("NewPolicy(%q) failed: %v", test.expr, err)
+			continue
+		}
+
+		files := append([]*FileAttr(nil), test.files...)
+		policy.Sort(files)
+
+		for i := range files {
+			if files[i] != test.want[i] {
+				t.Errorf("%q ranked %v at %v, want %v", test.expr, files[i].Path, i, test.want[i].Path)
+			}
+		}
+	}
+}
+
+func TestPolicyExprUnknownTime(t *testing.T) {
+	known := newTestFile("/a/known.jpg", 10, time.Now())
+	known.birthTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local).UnixNano()
+
+	unknown1 := newTestFile("/a/unknown1.jpg", 10, time.Now())
+	unknown2 := newTestFile("/a/unknown2.jpg", 10, time.Now())
+
+	// Files with unknown time are ranked last, whatever the input order is.
+	for _, expr := range []string{"older(btime)", "newer(btime)"} {
+		policy, err := NewPolicy(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, files := range [][]*FileAttr{
+			{unknown1, known, unknown2},
+			{unknown2, unknown1, known},
+			{known, unknown2, unknown1},
+		} {
+			files = append([]*FileAttr(nil), files...)
+			policy.Sort(files)
+
+			if files[0] != known {
+				t.Errorf("%q ranked %v first, want %v", expr, files[0].Path, known.Path)
+			}
+		}
+	}
+}
@@ -2,8 +2,8 @@
 package main
 
 import (
-	"os/user"
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
@@ -14,6 +14,20 @@ type Filter interface {
 
 	// Check if a folder or file needs to skip.
 	Skip(path, name string, isDir bool) bool
+
+	// Add a glob (or regular expression) pattern matching
+	// slash separated full paths of files and folders.
+	// Exclude patterns prune whole folders, include patterns
+	// are for files only.
+	AddPathFilter(pattern string, isRegex bool, exclude bool) error
+
+	// Check if content type of files is needed to
+	// decide whether to skip them, see SkipContentType().
+	NeedContentType() bool
+
+	// Check if a file needs to skip according to its content type,
+	// or its extention if the content type does not tell.
+	SkipContentType(name, contentType string) bool
 }
 
 type filterImpl struct {
@@ -25,35 +39,135 @@ type filterImpl struct {
 
 	// Exclude Extentions.
 	excludeExts map[string]bool
+
+	// Include and exclude types, e.g. "photo".
+	includeTypes map[string]bool
+	excludeTypes map[string]bool
+
+	// Detect types of files by content, they win over extensions.
+	sniff bool
+
+	// Include and exclude path patterns.
+	includePaths []*regexp.Regexp
+	excludePaths []*regexp.Regexp
 }
 
 var extentionMapping = map[string][]string{
 	"audio": {".aac", ".ac3", ".amr", ".ape", ".cda",
 		".dts", ".flac", ".m1a", ".m2a", ".m4a",
 		".mka", ".mp2", ".mp3", ".mpa", ".ra",
-		".tta", ".wav", ".wma", ".wv", ".mid"},
+		".tta", ".wav", ".wma", ".wv", ".mid",
+		".aif", ".aiff", ".oga", ".ogg", ".opus"},
 
 	"office": {".doc", ".dot", ".docx", ".docm", ".dotx", ".dotm", ".docb",
 		".xls", ".xlt", ".xlm", ".xlsx", ".xlsm", ".xltx", ".xltm", ".mpp",
 		".one", ".ppt", ".pot", ".pps", ".pptx", ".pptm", ".potx", ".potm",
 		".ppam", ".ppsx", ".ppsm", ".sldx", ".sldm", ".vsd", ".vsdx", ".vst",
-		".mdb", ".accdb", ".accde", ".accdt", ".accdr"},
+		".mdb", ".accdb", ".accde", ".accdt", ".accdr",
+		".odt", ".ods", ".odp", ".odg", ".rtf"},
 
 	"photo": {".bmp", ".emf", ".gif", ".ico", ".jpeg",
-		".jpg", ".png", ".psd", ".svg", ".tiff", ".wmf"},
+		".jpg", ".png", ".psd", ".svg", ".tiff", ".wmf",
+		".avif", ".heic", ".heif", ".jxl", ".tif", ".webp"},
+
+	"raw": {".3fr", ".arw", ".cr2", ".cr3", ".crw", ".dng",
+		".erf", ".kdc", ".mef", ".mos", ".mrw", ".nef", ".nrw",
+		".orf", ".pef", ".raf", ".rw2", ".rwl", ".sr2", ".srf", ".srw", ".x3f"},
 
 	"video": {".asf", ".avi", ".mov", ".mp4", ".mpg",
-		".rm", ".rmvb", ".vob", ".wmv"},
+		".rm", ".rmvb", ".vob", ".wmv",
+		".3gp", ".flv", ".m2ts", ".m4v", ".mkv", ".mpeg", ".mts", ".webm"},
+
+	"document": {".pdf", ".epub", ".mobi", ".azw", ".azw3",
+		".djvu", ".fb2", ".ps", ".xps"},
+
+	"source": {".c", ".h", ".cc", ".cpp", ".cxx", ".hpp", ".cs",
+		".go", ".rs", ".java", ".kt", ".scala", ".swift", ".m",
+		".py", ".rb", ".php", ".pl", ".lua", ".js", ".jsx", ".tsx",
+		".sh", ".ps1", ".bat", ".sql"},
 
 	"package": {".7z", ".ace", ".ar", ".arc", ".ari",
 		".arj", ".bz", ".bz2", ".bzip2", ".cab", ".deb",
 		".gho", ".gz", ".gzi", ".gzip", ".iso", ".lzma", ".msi",
 		".pkg", ".rar", ".rpm", ".tar", ".tar.gz", ".tgz", ".xz", ".z",
-		".zip", ".zipx", ".zz"},
+		".zip", ".zipx", ".zz",
+		".apk", ".dmg", ".tar.bz2", ".tar.xz", ".tar.zst", ".txz", ".zst"},
+}
+
+// All known extentions.
+var knownExtentions = func() map[string]bool {
+	exts := make(map[string]bool)
+
+	for _, list := range extentionMapping {
+		for _, ext := range list {
+			exts[ext] = true
+		}
+	}
+
+	return exts
+}()
+
+// Content type (MIME) mapping table, prefix of content type to file
+// types. The first one is used if the extention does not tell, others
+// share the same content format, e.g. raw files are TIFF and ".docx"
+// files are ZIP.
+var contentTypeMapping = []struct {
+	prefix    string
+	fileTypes []string
+}{
+	{"image/", []string{"photo", "raw"}},
+	{"audio/", []string{"audio", "video"}},
+	{"application/ogg", []string{"audio", "video"}},
+	{"video/", []string{"video", "audio"}},
+	{"application/x-ole-storage", []string{"office", "package"}},
+	{"application/pdf", []string{"document"}},
+	{"application/zip", []string{"package", "office", "document"}},
+	{"application/x-gzip", []string{"package"}},
+	{"application/x-rar-compressed", []string{"package"}},
+	{"application/x-7z-compressed", []string{"package"}},
+	{"application/x-bzip2", []string{"package"}},
+	{"application/x-xz", []string{"package"}},
+	{"application/x-tar", []string{"package"}},
+}
+
+// Get file types (e.g. "photo") of a content type,
+// nil is returned if it's unknown.
+func getFileTypes(contentType string) []string {
+	for _, item := range contentTypeMapping {
+		if strings.HasPrefix(contentType, item.prefix) {
+			return item.fileTypes
+		}
+	}
+
+	return nil
+}
+
+// Check if the extention of a file name belongs to any of the file types.
+func matchFileTypes(name string, fileTypes []string) bool {
+	ext := findExtention(name, knownExtentions)
+	if len(ext) == 0 {
+		return false
+	}
+
+	for _, fileType := range fileTypes {
+		for _, value := range extentionMapping[fileType] {
+			if value == ext {
+				return true
+			}
+		}
+	}
+
+	return false
 }
 
-func parseTypes(types string, exts map[string]bool) error {
+func parseTypes(types string, exts map[string]bool, fileTypes map[string]bool) error {
 	for _, value := range strings.Split(strings.ToLower(types), ",") {
+		// Extention, e.g. ".tar.zst".
+		if len(value) > 1 && value[0] == '.' {
+			exts[value] = true
+			continue
+		}
+
 		list, ok := extentionMapping[value]
 
 		// If it could not be found, then return error.
@@ -65,36 +179,39 @@ func parseTypes(types string, exts map[string]bool) error {
 		for _, str := range list {
 			exts[str] = true
 		}
+
+		fileTypes[value] = true
 	}
 
 	return nil
 }
 
 // Create a new filter object.
-func NewFilter(includes, excludes string) (Filter, error) {
+//
+// If "sniff" is true, then types of files are detected by
+// content (magic bytes), and they win over extensions.
+func NewFilter(includes, excludes string, sniff bool) (Filter, error) {
 	filter := &filterImpl{
-		includeExts: make(map[string]bool),
-		excludeExts: make(map[string]bool),
+		includeExts:  make(map[string]bool),
+		excludeExts:  make(map[string]bool),
+		includeTypes: make(map[string]bool),
+		excludeTypes: make(map[string]bool),
+		sniff:        sniff,
 	}
 
-	// Get $HOME.
-	if current, err := user.Current(); err != nil {
-		panic(err)
-	} else {
-		// Get "$HOME/.dedup".
-		filter.cacheDir = filepath.Join(current.HomeDir, ".dedup")
-	}
+	// Get "$HOME/.dedup".
+	filter.cacheDir = GetDedupDir()
 
 	// Include filters.
 	if len(includes) > 0 {
-		if err := parseTypes(includes, filter.includeExts); err != nil {
+		if err := parseTypes(includes, filter.includeExts, filter.includeTypes); err != nil {
 			return nil, err
 		}
 	}
 
 	// Exclude filters.
 	if len(excludes) > 0 {
-		if err := parseTypes(excludes, filter.excludeExts); err != nil {
+		if err := parseTypes(excludes, filter.excludeExts, filter.excludeTypes); err != nil {
 			return nil, err
 		}
 	}
@@ -112,6 +229,21 @@ func (me *filterImpl) Skip(path, name string, isDir bool) bool {
 		return true
 	}
 
+	// Path filters.
+	if len(me.includePaths) > 0 || len(me.excludePaths) > 0 {
+		slashPath := filepath.ToSlash(path)
+
+		// If it's a folder, then patterns like "**/.git/**" match it as well.
+		if matchPaths(me.excludePaths, slashPath) ||
+			(isDir && matchPaths(me.excludePaths, slashPath+"/")) {
+			return true
+		}
+
+		if !isDir && len(me.includePaths) > 0 && !matchPaths(me.includePaths, slashPath) {
+			return true
+		}
+	}
+
 	// Include and exclude filters are for files only,
 	// NOT for folders.
 	if isDir {
@@ -124,24 +256,126 @@ func (me *filterImpl) Skip(path, name string, isDir bool) bool {
 		return false
 	}
 
-	// Get file extention.
-	ext := strings.ToLower(filepath.Ext(name))
+	// Check its content later, the detected type wins.
+	if me.sniff {
+		return false
+	}
 
-	// If it's included by exclude filters, then skip it.
-	if _, ok := me.excludeExts[ext]; ok {
-		return true
+	return me.skipExtention(name)
+}
+
+// Check if a file needs to skip according to its extention.
+func (me *filterImpl) skipExtention(name string) bool {
+	// The longest matched extention wins.
+	if matched, excluded := me.matchExtention(name); matched {
+		return excluded
 	}
 
-	// Include filters.
-	if len(me.includeExts) > 0 {
-		if _, ok := me.includeExts[ext]; ok {
-			return false
+	// If include filters have been set, then any files
+	// that are not included by include filters will be skipped.
+	return len(me.includeExts) > 0
+}
+
+// Find the longest extention of a file name in the map,
+// e.g. ".tar.gz" and then ".gz" for "a.tar.gz".
+// "" is returned if no extention is found.
+func findExtention(name string, exts map[string]bool) string {
+	name = strings.ToLower(name)
+
+	for i := 0; i < len(name); i++ {
+		if name[i] == '.' && exts[name[i:]] {
+			return name[i:]
+		}
+	}
+
+	return ""
+}
+
+// Check if the longest extention of a file name is in include
+// or exclude filters, and if it's excluded. If the same extention
+// is in both, then exclude filters win.
+func (me *filterImpl) matchExtention(name string) (bool, bool) {
+	name = strings.ToLower(name)
+
+	for i := 0; i < len(name); i++ {
+		if name[i] != '.' {
+			continue
+		}
+
+		if me.excludeExts[name[i:]] {
+			return true, true
+		}
+
+		if me.includeExts[name[i:]] {
+			return true, false
+		}
+	}
+
+	return false, false
+}
+
+// Check if a slash separated path matches any pattern.
+func matchPaths(patterns []*regexp.Regexp, path string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(path) {
+			return true
 		}
+	}
+
+	return false
+}
 
-		// If include filters have been set, then any files
-		// that are not included by include filters will be skipped.
+func (me *filterImpl) AddPathFilter(pattern string, isRegex bool, exclude bool) error {
+	if len(pattern) == 0 {
+		return ErrInvalidPathFilters
+	}
+
+	var compiled *regexp.Regexp
+	var err error
+
+	if isRegex {
+		compiled, err = regexp.Compile(pattern)
+	} else {
+		compiled, err = CompileGlob(pattern)
+	}
+
+	if err != nil {
+		return ErrInvalidPathFilters
+	}
+
+	if exclude {
+		me.excludePaths = append(me.excludePaths, compiled)
+	} else {
+		me.includePaths = append(me.includePaths, compiled)
+	}
+
+	return nil
+}
+
+func (me *filterImpl) NeedContentType() bool {
+	return me.sniff && (len(me.includeExts) > 0 || len(me.excludeExts) > 0)
+}
+
+func (me *filterImpl) SkipContentType(name, contentType string) bool {
+	fileTypes := getFileTypes(contentType)
+
+	// If the content type is unknown, or it matches the extention
+	// (e.g. ".cr2" is "raw" but its content is TIFF), then the
+	// extention decides. Otherwise, the content type overrides it.
+	if len(fileTypes) == 0 || matchFileTypes(name, fileTypes) {
+		return me.skipExtention(name)
+	}
+
+	// If it's included by exclude filters, then skip it.
+	if me.excludeTypes[fileTypes[0]] {
 		return true
 	}
 
+	// If include filters have been set, then any files
+	// that are not included by include filters will be skipped.
+	if len(me.includeExts) > 0 {
+		return !me.includeTypes[fileTypes[0]]
+	}
+
 	return false
 }
@@ -0,0 +1,138 @@
+// File deduplication
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAddPathFilterErrors(t *testing.T) {
+	tests := []struct {
+		pattern string
+		isRegex bool
+		ok      bool
+	}{
+		{"", false, false},
+		{"", true, false},
+		{"node_modules", false, true},
+		{"(unclosed", false, true},
+		{"(unclosed", true, false},
+		{"[a-", true, false},
+		{"/(node_modules|\\.git)$", true, true},
+	}
+
+	for _, test := range tests {
+		filter, err := NewFilter("", "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = filter.AddPathFilter(test.pattern, test.isRegex, true)
+		if (err == nil) != test.ok {
+			t.Errorf("AddPathFilter(%q, %v) = %v, want ok %v", test.pattern, test.isRegex, err, test.ok)
+		}
+
+		if err != nil && err != ErrInvalidPathFilters {
+			t.Errorf("AddPathFilter(%q, %v) = %v, want %v", test.pattern, test.isRegex, err, ErrInvalidPathFilters)
+		}
+	}
+}
+
+func TestPathFilterSkip(t *testing.T) {
+	type pathFilter struct {
+		pattern string
+		isRegex bool
+		exclude bool
+	}
+
+	tests := []struct {
+		filters []pathFilter
+		path    string
+		isDir   bool
+		skip    bool
+	}{
+		// Excluded folders are pruned.
+		{[]pathFilter{{"node_modules", false, true}}, "/src/node_modules", true, true},
+		{[]pathFilter{{"node_modules", false, true}}, "/src/node_modules/a.js", false, false},
+		{[]pathFilter{{"node_modules", false, true}}, "/src/app/a.js", false, false},
+		{[]pathFilter{{"**/.git/**", false, true}}, "/src/.git", true, true},
+		{[]pathFilter{{"**/.git/**", false, true}}, "/src/.git", false, false},
+		{[]pathFilter{{"/\\.cache(/|$)", true, true}}, "/home/.cache", true, true},
+		{[]pathFilter{{"/\\.cache(/|$)", true, true}}, "/home/.cached", true, false},
+
+		// Include patterns are for files only.
+		{[]pathFilter{{"**/DCIM/**", false, false}}, "/card/DCIM/a.jpg", false, false},
+		{[]pathFilter{{"**/DCIM/**", false, false}}, "/card/MISC/a.jpg", false, true},
+		{[]pathFilter{{"**/DCIM/**", false, false}}, "/card/MISC", true, false},
+		{[]pathFilter{{"\\.jpe?g$", true, false}}, "/card/a.jpeg", false, false},
+		{[]pathFilter{{"\\.jpe?g$", true, false}}, "/card/a.png", false, true},
+
+		// Exclude patterns win over include patterns.
+		{[]pathFilter{{"**/DCIM/**", false, false}, {"*.tmp", false, true}}, "/card/DCIM/a.tmp", false, true},
+		{[]pathFilter{{"**/DCIM/**", false, false}, {"*.tmp", false, true}}, "/card/DCIM/a.jpg", false, false},
+	}
+
+	for _, test := range tests {
+		filter, err := NewFilter("", "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, item := range test.filters {
+			if err := filter.AddPathFilter(item.pattern, item.isRegex, item.exclude); err != nil {
+				t.Fatalf("AddPathFilter(%q) failed: %v", item.pattern, err)
+			}
+		}
+
+		path := filepath.FromSlash(test.path)
+		if skip := filter.Skip(path, filepath.Base(path), test.isDir); skip != test.skip {
+			t.Errorf("%v: Skip(%q, %v) = %v, want %v", test.filters, test.path, test.isDir, skip, test.skip)
+		}
+	}
+}
+
+func TestSniffedTypes(t *testing.T) {
+	tests := []struct {
+		includes    string
+		excludes    string
+		name        string
+		contentType string
+		skip        bool
+	}{
+		// Unknown extentions.
+		{"photo", "", "IMG_1234", "image/jpeg", false},
+		{"photo", "", "IMG_1234", "text/plain; charset=utf-8", true},
+		{"", "photo", "a.dat", "image/png", true},
+		{"", "photo", "a.dat", "application/octet-stream", false},
+
+		// Detected types win over extentions.
+		{"photo", "", "a.zip", "image/jpeg", false},
+		{"photo", "", "a.jpg", "application/zip", true},
+		{"", "package", "a.zip", "image/jpeg", false},
+		{"", "photo", "a.txt", "image/png", true},
+
+		// Extentions decide if content is unknown or shared by their types.
+		{"photo", "", "a.jpg", "application/octet-stream", false},
+		{"raw", "", "a.cr2", "image/tiff", false},
+		{"office", "", "a.docx", "application/zip", false},
+		{"", "office", "a.docx", "application/zip", true},
+		{"photo,.dat", "", "a.dat", "application/octet-stream", false},
+	}
+
+	for _, test := range tests {
+		filter, err := NewFilter(test.includes, test.excludes, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if filter.Skip(filepath.FromSlash("/a/"+test.name), test.name, false) || !filter.NeedContentType() {
+			t.Errorf("-i %q -e %q, %v is skipped by name", test.includes, test.excludes, test.name)
+			continue
+		}
+
+		if skip := filter.SkipContentType(test.name, test.contentType); skip != test.skip {
+			t.Errorf("-i %q -e %q, SkipContentType(%q, %q) = %v, want %v",
+				test.includes, test.excludes, test.name, test.contentType, skip, test.skip)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// File deduplication
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func usageFind() {
+	fmt.Println("Usage: dedup find [-v] [-i <TYPE>,...] [-e <TYPE>,...] [-sniff] [-x <GLOB>,...] [-xr <REGEX>] [-ix <GLOB>,...] [-ixr <REGEX>] [-gitignore] [-xattr <MODE>] <file>... -- <path>...")
+	fmt.Println("       dedup find [-v] [-i <TYPE>,...] [-e <TYPE>,...] [-sniff] [-x <GLOB>,...] [-xr <REGEX>] [-ix <GLOB>,...] [-ixr <REGEX>] [-gitignore] [-xattr <MODE>] <file> <path>...")
+	fmt.Println()
+	fmt.Println("Find all copies of specified files.")
+	fmt.Println()
+	fmt.Println("Options and Arguments:")
+	fmt.Println("    <file>:    Target files whose copies will be found.")
+	fmt.Println("    <path>:    Paths to search.")
+	fmt.Println()
+	fmt.Println("    Remark: Use \"--\" to separate target files and paths")
+	fmt.Println("            if there are more than one target file.")
+	fmt.Println()
+}
+
+// Split "<file>... -- <path>..." or "<file> <path>...".
+func splitFindArgs(args []string) ([]string, []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[0:i], args[i+1:]
+		}
+	}
+
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	return args[0:1], args[1:]
+}
+
+// Check if a file is excluded by filters, see fileScannerImpl.scanFile().
+func isExcluded(filter Filter, path string, info os.FileInfo) bool {
+	if filter.Skip(path, info.Name(), false) {
+		return true
+	}
+
+	if !filter.NeedContentType() {
+		return false
+	}
+
+	// If it could not be read, then its extention decides.
+	contentType, _ := SniffContentType(path)
+	return filter.SkipContentType(info.Name(), contentType)
+}
+
+// "dedup find <file>... -- <path>..."
+func mainFind(args []string) int {
+	var options scanOptions
+
+	// Parse command line options.
+	flags := flag.NewFlagSet("find", flag.ContinueOnError)
+	flags.Usage = usageFind
+	options.addFlags(flags)
+	if err := parseFlags(flags, "find", args); err != nil {
+		return 1
+	}
+
+	// If argument is missing, then exit.
+	targets, roots := splitFindArgs(flags.Args())
+	if len(targets) == 0 || len(roots) == 0 {
+		usageFind()
+		return 1
+	}
+
+	// Target files excluded by filters could not be found.
+	filter, err := options.newFilter()
+	if err != nil {
+		return 1
+	}
+
+	// Only files whose sizes are the same as
+	// target files need to calculate hashes.
+	sizes := make(map[int64]bool)
+	for i, target := range targets {
+		abs, err := GetAbsPath(target)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid argument %v (%v)\n", target, err)
+			return 1
+		}
+
+		info, err := os.Stat(abs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		} else if !info.Mode().IsRegular() {
+			fmt.Fprintf(os.Stderr, "%v is not a regular file.\n", target)
+			return 1
+		} else if isExcluded(filter, abs, info) {
+			fmt.Fprintf(os.Stderr, "%v is excluded by filters (-i, -e, -x, -xr, -ix, -ixr).\n", target)
+			return 1
+		}
+
+		targets[i] = abs
+		sizes[info.Size()] = true
+	}
+
+	// Target files are scanned together with other paths,
+	// so the cache file is shared.
+	scanner, updater, err := options.newScanner(append(roots, targets...))
+	if err != nil {
+		return 1
+	}
+
+	// Hard links of target files are copies as well.
+	scanner.SetSizeFilter(sizes)
+	scanner.SetKeepHardLinks(true)
+
+	if err := scanner.Scan(); err != nil {
+		return 1
+	}
+
+	// Update local cache.
+	scanner.SaveCache()
+
+	// Map of scanned files, the key is file path.
+	files := make(map[string]*FileAttr, scanner.GetTotalFiles())
+	for _, file := range getSortedScannedFiles(scanner) {
+		files[GetPathAsKey(file.Path)] = file
+	}
+
+	// Result variables
+	var copies int = 0
+
+	for _, target := range targets {
+		file, ok := files[GetPathAsKey(target)]
+		if !ok {
+			updater.IncreaseErrors()
+			updater.Log(LOG_ERROR, "Could not calculate checksum for %v.", target)
+			continue
+		}
+
+		updater.Log(LOG_INFO, "<Copies of %v>", target)
+
+		for _, item := range scanner.GetScannedFiles()[file.SHA256] {
+			// Check file size here to avoid hash collision.
+			if item == file || item.Size != file.Size {
+				continue
+			}
+
+			if file.Id.IsValid() && item.Id == file.Id {
+				updater.Log(LOG_INFO, "%v (hard link)", item.Path)
+			} else {
+				updater.Log(LOG_INFO, "%v", item.Path)
+			}
+
+			copies++
+		}
+
+		updater.Log(LOG_INFO, "")
+	}
+
+	logScanSummary(scanner, updater)
+	updater.Log(LOG_INFO, "Copies:           %v", copies)
+
+	if updater.Errors() > 0 {
+		updater.Log(LOG_INFO, "Errors:           %v", updater.Errors())
+	}
+
+	return 0
+}
@@ -0,0 +1,198 @@
+// File deduplication
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+const (
+	// Groups with more wasted bytes come first.
+	GROUP_ORDER_WASTED = iota
+
+	// Groups with larger files come first.
+	GROUP_ORDER_SIZE
+
+	// Sort groups by SHA256 hash.
+	GROUP_ORDER_HASH
+
+	// Sort groups by path of the file to keep.
+	GROUP_ORDER_PATH
+)
+
+// Group order mapping table.
+var groupOrderMapping = map[string]int{
+	"wasted": GROUP_ORDER_WASTED,
+	"size":   GROUP_ORDER_SIZE,
+	"hash":   GROUP_ORDER_HASH,
+	"path":   GROUP_ORDER_PATH,
+}
+
+// Convert "-sort <ORDER>" argument to GROUP_ORDER_???.
+func ParseGroupOrder(order string) (int, error) {
+	if len(order) == 0 {
+		return GROUP_ORDER_PATH, nil
+	}
+
+	if value, ok := groupOrderMapping[strings.ToLower(order)]; ok {
+		return value, nil
+	}
+
+	return GROUP_ORDER_PATH, ErrInvalidGroupOrder
+}
+
+// Get wasted bytes of a duplicated group.
+func getWastedBytes(files []*FileAttr) int64 {
+	return files[0].Size * int64(len(files)-1)
+}
+
+// Get all groups of duplicated files.
+//
+// Files of each group are ranked by policy, so the first file
+// needs to keep. Groups are sorted by "order" (GROUP_ORDER_???).
+// Map iteration order and scanning order do not matter,
+// so the result is always the same for the same files.
+func GetDuplicatedGroups(scanner FileScanner, policy Policy, order int) [][]*FileAttr {
+	groups := make([][]*FileAttr, 0, 64)
+
+	for _, item := range scanner.GetScannedFiles() {
+		// If no duplicated files, then skip.
+		if len(item) <= 1 {
+			continue
+		}
+
+		// Scanning order is not stable.
+		sort.Slice(item, func(i, j int) bool {
+			return item[i].Path < item[j].Path
+		})
+
+		// Once returned, files are ranked, item[0] needs to keep
+		// and the rest could be removed.
+		policy.Sort(item)
+
+		groups = append(groups, item)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		first, second := groups[i], groups[j]
+
+		switch order {
+		case GROUP_ORDER_WASTED:
+			if getWastedBytes(first) != getWastedBytes(second) {
+				return getWastedBytes(first) > getWastedBytes(second)
+			}
+
+		case GROUP_ORDER_SIZE:
+			if first[0].Size != second[0].Size {
+				return first[0].Size > second[0].Size
+			}
+
+		case GROUP_ORDER_HASH:
+			if result := bytes.Compare(first[0].SHA256[:], second[0].SHA256[:]); result != 0 {
+				return result < 0
+			}
+		}
+
+		return first[0].Path < second[0].Path
+	})
+
+	return groups
+}
+
+const (
+	// Kept files could be anywhere.
+	KEEP_DISTINCT_NONE = iota
+
+	// Prefer kept files on distinct devices.
+	KEEP_DISTINCT_DEVICE
+
+	// Prefer kept files under distinct command line paths (roots).
+	KEEP_DISTINCT_ROOT
+)
+
+// Keep distinct mapping table.
+var keepDistinctMapping = map[string]int{
+	"device": KEEP_DISTINCT_DEVICE,
+	"root":   KEEP_DISTINCT_ROOT,
+}
+
+// Convert "-distinct <WHAT>" argument to KEEP_DISTINCT_???.
+func ParseKeepDistinct(distinct string) (int, error) {
+	if len(distinct) == 0 {
+		return KEEP_DISTINCT_NONE, nil
+	}
+
+	if value, ok := keepDistinctMapping[strings.ToLower(distinct)]; ok {
+		return value, nil
+	}
+
+	return KEEP_DISTINCT_NONE, ErrInvalidKeepDistinct
+}
+
+// Get the key which kept files must not share.
+//
+// The second return value is false if it's unknown,
+// e.g. device is not available on this platform.
+func getDistinctKey(file *FileAttr, distinct int) (uint64, bool) {
+	switch distinct {
+	case KEEP_DISTINCT_DEVICE:
+		// Device is 0 if it's unknown.
+		return file.Id.Device, file.Id.Device != 0
+
+	case KEEP_DISTINCT_ROOT:
+		return uint64(file.Root), true
+	}
+
+	return 0, false
+}
+
+// Select files to keep from a duplicated group.
+//
+// Files should be ranked by policy, and min(keep, len(files)) files
+// are kept. If "distinct" is not KEEP_DISTINCT_NONE, then the best
+// file of each device (or root) is kept first, and remaining slots
+// are filled by the next ranked files, so that distinct copies are
+// preferred but never fewer files are kept. If the device of any file
+// is unknown, then files are kept by rank only.
+//
+// Once returned, files[0:n] need to keep and the rest
+// of files could be removed, where n is the return value.
+func SelectKeepers(files []*FileAttr, keep int, distinct int) int {
+	if keep > len(files) {
+		keep = len(files)
+	}
+
+	if distinct == KEEP_DISTINCT_NONE {
+		return keep
+	}
+
+	keepers := make([]*FileAttr, 0, keep)
+	others := make([]*FileAttr, 0, len(files))
+	keys := make(map[uint64]bool)
+
+	for _, file := range files {
+		key, ok := getDistinctKey(file, distinct)
+		if !ok {
+			return keep
+		}
+
+		if len(keepers) < keep && !keys[key] {
+			keys[key] = true
+			keepers = append(keepers, file)
+		} else {
+			others = append(others, file)
+		}
+	}
+
+	// Not enough devices (or roots), fill remaining
+	// slots with the next ranked files.
+	missing := keep - len(keepers)
+	keepers = append(keepers, others[0:missing]...)
+	others = others[missing:]
+
+	copy(files, keepers)
+	copy(files[len(keepers):], others)
+
+	return len(keepers)
+}
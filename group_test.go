@@ -0,0 +1,67 @@
+// File deduplication
+package main
+
+import (
+	"testing"
+)
+
+func TestSelectKeepers(t *testing.T) {
+	// Create ranked files, each one is "<device><root>", e.g. "21"
+	// means device 2 and root 1. Device 0 means that it's unknown.
+	newFiles := func(specs ...string) []*FileAttr {
+		files := make([]*FileAttr, 0, len(specs))
+
+		for _, spec := range specs {
+			files = append(files, &FileAttr{
+				Path: spec,
+				Id:   FileId{Device: uint64(spec[0] - '0'), Inode: 1},
+				Root: int(spec[1] - '0'),
+			})
+		}
+
+		return files
+	}
+
+	tests := []struct {
+		files    []*FileAttr
+		keep     int
+		distinct int
+		want     string
+	}{
+		{newFiles("11", "12", "21"), 1, KEEP_DISTINCT_NONE, "11"},
+		{newFiles("11", "12", "21"), 2, KEEP_DISTINCT_NONE, "11,12"},
+		{newFiles("11", "12"), 5, KEEP_DISTINCT_NONE, "11,12"},
+
+		// Distinct copies are preferred.
+		{newFiles("11", "12", "21"), 2, KEEP_DISTINCT_DEVICE, "11,21"},
+		{newFiles("11", "12", "21"), 2, KEEP_DISTINCT_ROOT, "11,12"},
+		{newFiles("11", "21", "12"), 2, KEEP_DISTINCT_ROOT, "11,12"},
+
+		// Not enough devices, the next ranked files are kept.
+		{newFiles("11", "12", "13"), 2, KEEP_DISTINCT_DEVICE, "11,12"},
+		{newFiles("11", "12", "21", "13"), 3, KEEP_DISTINCT_DEVICE, "11,21,12"},
+		{newFiles("11", "12"), 5, KEEP_DISTINCT_DEVICE, "11,12"},
+
+		// Unknown devices, files are kept by rank only.
+		{newFiles("01", "02", "03"), 2, KEEP_DISTINCT_DEVICE, "01,02"},
+		{newFiles("11", "02", "21"), 2, KEEP_DISTINCT_DEVICE, "11,02"},
+	}
+
+	for _, test := range tests {
+		count := SelectKeepers(test.files, test.keep, test.distinct)
+
+		kept := ""
+		for i, file := range test.files[0:count] {
+			if i > 0 {
+				kept += ","
+			}
+
+			kept += file.Path
+		}
+
+		if kept != test.want {
+			t.Errorf("SelectKeepers(keep %v, distinct %v) = %v, want %v",
+				test.keep, test.distinct, kept, test.want)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// File deduplication
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Ignore file name, it has the same syntax as ".gitignore".
+const IGNORE_FILE_NAME = ".dedupignore"
+
+// Git ignore file name, see "-gitignore".
+const GIT_IGNORE_FILE_NAME = ".gitignore"
+
+// A pattern of ignore file.
+type ignoreRule struct {
+	pattern *regexp.Regexp
+
+	// "!pattern", files matching it are not ignored.
+	negate bool
+
+	// "pattern/", it matches folders only.
+	folderOnly bool
+}
+
+// Ignore rules of a folder, they are inherited by sub-folders.
+//
+// Rules of deeper folders override rules of parent folders,
+// and later rules override earlier ones in the same folder.
+type ignoreRules struct {
+	parent *ignoreRules
+
+	// Folder containing ignore files.
+	folder string
+
+	rules []*ignoreRule
+}
+
+// Convert a pattern of ignore file to regular expression,
+// which matches slash separated path relative to the folder
+// containing the ignore file.
+//
+// 1) "*" and "?" do not match "/", "[...]" matches a character in the set.
+// 2) "**/" at the beginning matches any folders, "/**" at the end
+// matches anything inside, "/**/" matches zero or more folders.
+// 3) A pattern with "/" at the beginning or in the middle is relative
+// to the folder, otherwise it matches names at any level.
+func compileIgnorePattern(pattern string) (*regexp.Regexp, error) {
+	var builder strings.Builder
+
+	if os.PathSeparator != '/' {
+		builder.WriteString("(?i)")
+	}
+
+	if strings.Contains(pattern, "/") {
+		pattern = strings.TrimPrefix(pattern, "/")
+		builder.WriteString("^")
+	} else {
+		builder.WriteString("(^|/)")
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			builder.WriteString("(.*/)?")
+			i += 2
+
+		case pattern[i:] == "**":
+			builder.WriteString(".*")
+			i++
+
+		case pattern[i] == '*':
+			builder.WriteString("[^/]*")
+
+		case pattern[i] == '?':
+			builder.WriteString("[^/]")
+
+		case pattern[i] == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				builder.WriteString(regexp.QuoteMeta("["))
+				break
+			}
+
+			set := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(set, "!") {
+				set = "^" + set[1:]
+			}
+
+			builder.WriteString("[" + strings.ReplaceAll(set, "\\", "\\\\") + "]")
+			i += end + 1
+
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			builder.WriteString(regexp.QuoteMeta(pattern[i+1 : i+2]))
+			i++
+
+		default:
+			builder.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	builder.WriteString("$")
+
+	return regexp.Compile(builder.String())
+}
+
+// Parse a line of ignore file, nil is returned
+// if it's a blank line or a comment.
+func parseIgnoreRule(line string) (*ignoreRule, error) {
+	// Trailing spaces are ignored unless they are escaped.
+	line = strings.TrimRight(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[0 : len(line)-1]
+	}
+
+	if len(line) == 0 || line[0] == '#' {
+		return nil, nil
+	}
+
+	rule := &ignoreRule{}
+
+	if line[0] == '!' {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\#") || strings.HasPrefix(line, "\\!") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.folderOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if len(line) == 0 {
+		return nil, nil
+	}
+
+	pattern, err := compileIgnorePattern(line)
+	if err != nil {
+		return nil, err
+	}
+
+	rule.pattern = pattern
+	return rule, nil
+}
+
+// Read ignore files of a folder.
+//
+// If there is no ignore file (or rule), then "parent" is returned.
+// Lines which could not be parsed are returned as well.
+func readIgnoreFiles(folder string, names []string, parent *ignoreRules) (*ignoreRules, []string) {
+	result := parent
+	var invalid []string
+
+	for _, name := range names {
+		fp, err := os.Open(AppendPath(folder, name))
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(fp)
+		for scanner.Scan() {
+			rule, err := parseIgnoreRule(scanner.Text())
+			if err != nil {
+				invalid = append(invalid, scanner.Text())
+				continue
+			}
+
+			if rule == nil {
+				continue
+			}
+
+			if result == parent {
+				result = &ignoreRules{parent: parent, folder: folder}
+			}
+
+			result.rules = append(result.rules, rule)
+		}
+
+		fp.Close()
+	}
+
+	return result, invalid
+}
+
+// Check if a file (or folder) needs to ignore.
+func (me *ignoreRules) Match(path string, isDir bool) bool {
+	for level := me; level != nil; level = level.parent {
+		relPath := filepath.ToSlash(path[len(level.folder)+1:])
+
+		for i := len(level.rules) - 1; i >= 0; i-- {
+			rule := level.rules[i]
+
+			if rule.folderOnly && !isDir {
+				continue
+			}
+
+			if rule.pattern.MatchString(relPath) {
+				return !rule.negate
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,266 @@
+// File deduplication
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompileIgnorePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		// Patterns without "/" match names at any level.
+		{"*.tmp", "a.tmp", true},
+		{"*.tmp", "sub/a.tmp", true},
+		{"*.tmp", "a.tmp.bak", false},
+		{"a?c", "abc", true},
+		{"a?c", "a/c", false},
+
+		// Patterns with "/" are relative to the folder.
+		{"/build", "build", true},
+		{"/build", "sub/build", false},
+		{"doc/*.txt", "doc/a.txt", true},
+		{"doc/*.txt", "doc/sub/a.txt", false},
+		{"doc/*.txt", "sub/doc/a.txt", false},
+
+		// "**"
+		{"**/cache", "cache", true},
+		{"**/cache", "a/b/cache", true},
+		{"cache/**", "cache/a/b", true},
+		{"cache/**", "cache", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "xa/b", false},
+
+		// Character sets and escaping.
+		{"[abc].txt", "b.txt", true},
+		{"[abc].txt", "d.txt", false},
+		{"[!abc].txt", "d.txt", true},
+		{"[!abc].txt", "a.txt", false},
+		{"\\*.txt", "*.txt", true},
+		{"\\*.txt", "a.txt", false},
+		{"a.txt", "abtxt", false},
+		{"[", "[", true},
+		{"a+(b)", "a+(b)", true},
+	}
+
+	for _, test := range tests {
+		pattern, err := compileIgnorePattern(test.pattern)
+		if err != nil {
+			t.Errorf("compileIgnorePattern(%q) failed: %v", test.pattern, err)
+			continue
+		}
+
+		if match := pattern.MatchString(test.path); match != test.match {
+			t.Errorf("%q matching %q = %v, want %v", test.pattern, test.path, match, test.match)
+		}
+	}
+}
+
+func TestParseIgnoreRule(t *testing.T) {
+	tests := []struct {
+		line       string
+		empty      bool
+		negate     bool
+		folderOnly bool
+	}{
+		{"", true, false, false},
+		{"   ", true, false, false},
+		{"# comment", true, false, false},
+		{"/", true, false, false},
+		{"*.tmp", false, false, false},
+		{"*.tmp  ", false, false, false},
+		{"!keep.tmp", false, true, false},
+		{"build/", false, false, true},
+		{"!build/", false, true, true},
+		{"\\#name", false, false, false},
+		{"\\!name", false, false, false},
+	}
+
+	for _, test := range tests {
+		rule, err := parseIgnoreRule(test.line)
+		if err != nil {
+			t.Errorf("parseIgnoreRule(%q) failed: %v", test.line, err)
+			continue
+		}
+
+		if (rule == nil) != test.empty {
+			t.Errorf("parseIgnoreRule(%q) = %v, want empty %v", test.line, rule, test.empty)
+			continue
+		}
+
+		if rule != nil && (rule.negate != test.negate || rule.folderOnly != test.folderOnly) {
+			t.Errorf("parseIgnoreRule(%q) = negate %v, folder only %v, want %v, %v",
+				test.line, rule.negate, rule.folderOnly, test.negate, test.folderOnly)
+		}
+	}
+
+	// Escaped "#" and "!" are literal characters.
+	for _, line := range []string{"\\#name", "\\!name"} {
+		rule, _ := parseIgnoreRule(line)
+		if !rule.pattern.MatchString(line[1:]) {
+			t.Errorf("%q does not match %q", line, line[1:])
+		}
+	}
+}
+
+// Create ignore rules of a folder from lines.
+func newTestIgnoreRules(t *testing.T, folder string, parent *ignoreRules, lines ...string) *ignoreRules {
+	rules := &ignoreRules{parent: parent, folder: folder}
+
+	for _, line := range lines {
+		rule, err := parseIgnoreRule(line)
+		if err != nil || rule == nil {
+			t.Fatalf("parseIgnoreRule(%q) = %v, %v", line, rule, err)
+		}
+
+		rules.rules = append(rules.rules, rule)
+	}
+
+	return rules
+}
+
+func TestIgnoreRulesMatch(t *testing.T) {
+	root := filepath.FromSlash("/data")
+	sub := filepath.Join(root, "sub")
+
+	rootRules := newTestIgnoreRules(t, root, nil, "*.log", "build/", "!important.log", "/top")
+	subRules := newTestIgnoreRules(t, sub, rootRules, "!*.log", "*.tmp", "!keep.tmp")
+
+	tests := []struct {
+		rules *ignoreRules
+		path  string
+		isDir bool
+		match bool
+	}{
+		{nil, "/data/a.log", false, false},
+
+		// Negation, the last matched rule wins.
+		{rootRules, "/data/a.log", false, true},
+		{rootRules, "/data/important.log", false, false},
+		{rootRules, "/data/x/important.log", false, false},
+
+		// Folder only patterns.
+		{rootRules, "/data/build", true, true},
+		{rootRules, "/data/x/build", true, true},
+		{rootRules, "/data/build", false, false},
+
+		// Anchored patterns.
+		{rootRules, "/data/top", false, true},
+		{rootRules, "/data/x/top", false, false},
+
+		// Deeper rules override parent rules.
+		{subRules, "/data/sub/a.log", false, false},
+		{subRules, "/data/sub/a.tmp", false, true},
+		{subRules, "/data/sub/keep.tmp", false, false},
+		{subRules, "/data/sub/build", true, true},
+		{subRules, "/data/sub/a.txt", false, false},
+	}
+
+	for _, test := range tests {
+		path := filepath.FromSlash(test.path)
+
+		if match := test.rules.Match(path, test.isDir); match != test.match {
+			t.Errorf("Match(%q, %v) = %v, want %v", test.path, test.isDir, match, test.match)
+		}
+	}
+}
+
+func TestReadIgnoreFiles(t *testing.T) {
+	folder := t.TempDir()
+
+	content := "# comment\n\n*.tmp\r\n!keep.tmp\ncache/\n"
+	if err := os.WriteFile(filepath.Join(folder, IGNORE_FILE_NAME), []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, invalid := readIgnoreFiles(folder, []string{IGNORE_FILE_NAME, GIT_IGNORE_FILE_NAME}, nil)
+	if rules == nil || len(rules.rules) != 3 || len(invalid) != 0 {
+		t.Fatalf("readIgnoreFiles() = %v, %v", rules, invalid)
+	}
+
+	// No ignore files, parent rules are returned.
+	empty := t.TempDir()
+	if result, _ := readIgnoreFiles(empty, []string{IGNORE_FILE_NAME}, rules); result != rules {
+		t.Errorf("readIgnoreFiles() of empty folder = %v, want parent", result)
+	}
+}
+
+func TestScanSkipsIgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+
+	files := map[string]string{
+		"a/" + IGNORE_FILE_NAME:     "*.tmp\n",
+		"b/" + IGNORE_FILE_NAME:     "*.tmp\n",
+		"a/" + GIT_IGNORE_FILE_NAME: "*.o\n",
+		"b/" + GIT_IGNORE_FILE_NAME: "*.o\n",
+		"a/data.txt":                "data",
+		"b/data.txt":                "data",
+		"a/x.tmp":                   "tmp",
+		"b/x.tmp":                   "tmp",
+		"a/cache/c.txt":             "cache",
+		"b/cache/c.txt":             "cache",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Ignore all folders named "cache".
+	if err := os.WriteFile(filepath.Join(root, IGNORE_FILE_NAME), []byte("cache/\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ignoreFiles []string
+		names       []string
+	}{
+		{[]string{IGNORE_FILE_NAME}, []string{"data.txt", GIT_IGNORE_FILE_NAME}},
+		{[]string{IGNORE_FILE_NAME, GIT_IGNORE_FILE_NAME}, []string{"data.txt"}},
+	}
+
+	for _, test := range tests {
+		filter, err := NewFilter("", "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		scanner := NewFileScanner([]string{root}, filter, NewUpdater(false), XATTR_MODE_OFF)
+		scanner.SetIgnoreFiles(test.ignoreFiles)
+
+		if err := scanner.Scan(); err != nil {
+			t.Fatal(err)
+		}
+
+		names := make(map[string]bool)
+		for _, list := range scanner.GetScannedFiles() {
+			for _, file := range list {
+				names[file.Name] = true
+			}
+		}
+
+		if len(names) != len(test.names) {
+			t.Errorf("ignore files %v, scanned %v, want %v", test.ignoreFiles, names, test.names)
+			continue
+		}
+
+		for _, name := range test.names {
+			if !names[name] {
+				t.Errorf("ignore files %v, scanned %v, want %v", test.ignoreFiles, names, test.names)
+				break
+			}
+		}
+	}
+}
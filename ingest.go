@@ -0,0 +1,272 @@
+// File deduplication
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Default layout of ingested files.
+const DEFAULT_INGEST_TEMPLATE = "{year}/{month}/{name}"
+
+// Placeholders in ingest template.
+var templatePattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// Placeholder mapping table.
+//
+// "relPath" is path relative to source folder, separated by "/".
+var templateMapping = map[string]func(file *FileAttr, relPath string) string{
+	"{year}":  func(file *FileAttr, relPath string) string { return time.Unix(0, file.ModTime).Format("2006") },
+	"{month}": func(file *FileAttr, relPath string) string { return time.Unix(0, file.ModTime).Format("01") },
+	"{day}":   func(file *FileAttr, relPath string) string { return time.Unix(0, file.ModTime).Format("02") },
+	"{name}":  func(file *FileAttr, relPath string) string { return file.Name },
+	"{ext}":   func(file *FileAttr, relPath string) string { return filepath.Ext(file.Name) },
+	"{path}":  func(file *FileAttr, relPath string) string { return relPath },
+	"{dir}":   func(file *FileAttr, relPath string) string { return path.Dir(relPath) },
+
+	"{base}": func(file *FileAttr, relPath string) string {
+		return strings.TrimSuffix(file.Name, filepath.Ext(file.Name))
+	},
+}
+
+// Check if all placeholders of a template are valid.
+func checkTemplate(template string) error {
+	for _, name := range templatePattern.FindAllString(template, -1) {
+		if _, ok := templateMapping[name]; !ok {
+			return ErrInvalidTemplate
+		}
+	}
+
+	if len(template) == 0 || path.IsAbs(template) || filepath.IsAbs(template) {
+		return ErrInvalidTemplate
+	}
+
+	return nil
+}
+
+// Get target path of a file according to template.
+func expandTemplate(template, folder string, file *FileAttr, relPath string) (string, error) {
+	str := templatePattern.ReplaceAllStringFunc(template, func(name string) string {
+		return templateMapping[name](file, relPath)
+	})
+
+	target := filepath.Join(folder, filepath.FromSlash(str))
+
+	// Template must not point to outside of target folder.
+	if !SameOrIsChild(folder, target) || SamePath(folder, target) {
+		return "", ErrInvalidTemplate
+	}
+
+	return target, nil
+}
+
+func usageIngest() {
+	fmt.Println("Usage: dedup ingest [-v] [-l] [-i <TYPE>,...] [-e <TYPE>,...] [-sniff] [-x <GLOB>,...] [-xr <REGEX>] [-ix <GLOB>,...] [-ixr <REGEX>] [-gitignore] [-xattr <MODE>] [-d <folder>] [-t <TEMPLATE>] <source> <library>")
+	fmt.Println()
+	fmt.Println("Copy files whose content does not exist in <library> yet.")
+	fmt.Println()
+	fmt.Println("Options and Arguments:")
+	fmt.Println("    -l:        List files only, do not copy them.")
+	fmt.Println("    -d:        Target folder, default value is <library>.")
+	fmt.Println("    -t:        Layout of copied files, default value is \"" + DEFAULT_INGEST_TEMPLATE + "\".")
+	fmt.Println()
+	fmt.Println("<TEMPLATE>:")
+	fmt.Println("    {year}:    Year of last modification time, e.g. \"2015\".")
+	fmt.Println("    {month}:   Month of last modification time, e.g. \"09\".")
+	fmt.Println("    {day}:     Day of last modification time, e.g. \"30\".")
+	fmt.Println("    {name}:    File name, e.g. \"IMG_1234.JPG\".")
+	fmt.Println("    {base}:    File name without extension, e.g. \"IMG_1234\".")
+	fmt.Println("    {ext}:     File extension, e.g. \".JPG\".")
+	fmt.Println("    {path}:    Path relative to <source>, e.g. \"DCIM/100CANON/IMG_1234.JPG\".")
+	fmt.Println("    {dir}:     Folder relative to <source>, e.g. \"DCIM/100CANON\".")
+	fmt.Println()
+	fmt.Println("    Remark: If target file already exists, then a number is appended")
+	fmt.Println("            to file name, e.g. \"IMG_1234-1.JPG\".")
+	fmt.Println()
+}
+
+// Get sizes of all regular files in a folder.
+func getFileSizes(root string) map[int64]bool {
+	sizes := make(map[int64]bool)
+
+	filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				sizes[info.Size()] = true
+			}
+		}
+
+		return nil
+	})
+
+	return sizes
+}
+
+// Command line options of "dedup ingest".
+type ingestOptions struct {
+	scanOptions
+	list     bool
+	folder   string
+	template string
+}
+
+// Register flags of "dedup ingest" to a flag set.
+func (me *ingestOptions) addFlags(flags *flag.FlagSet) {
+	me.scanOptions.addFlags(flags)
+	flags.BoolVar(&me.list, "l", false, "List files only, do not copy them.")
+	flags.StringVar(&me.folder, "d", "", "Target folder.")
+	flags.StringVar(&me.template, "t", DEFAULT_INGEST_TEMPLATE, "Layout of copied files.")
+}
+
+// "dedup ingest <source> <library>"
+func mainIngest(args []string) int {
+	var options ingestOptions
+
+	// Parse command line options.
+	flags := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	flags.Usage = usageIngest
+	options.addFlags(flags)
+	if err := parseFlags(flags, "ingest", args); err != nil {
+		return 1
+	}
+
+	// If argument is missing, then exit.
+	if flags.NArg() != 2 {
+		usageIngest()
+		return 1
+	}
+
+	if err := checkTemplate(options.template); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	// Convert input paths to absolute.
+	roots, err := getAbsUniquePaths(flags.Args()[0:1])
+	if err != nil {
+		return 1
+	}
+	source := roots[0]
+
+	if roots, err = getAbsUniquePaths(flags.Args()[1:2]); err != nil {
+		return 1
+	}
+	library := roots[0]
+
+	if len(options.folder) == 0 {
+		options.folder = library
+	} else if options.folder, err = GetAbsPath(options.folder); err != nil || len(options.folder) == 0 {
+		fmt.Fprintf(os.Stderr, "Invalid argument -d (%v)\n", err)
+		return 1
+	}
+
+	// Files in library whose sizes are different from
+	// all source files do not need to calculate hashes.
+	scanner, updater, err := options.newScanner([]string{source, library})
+	if err != nil {
+		return 1
+	}
+
+	// A source file which is a hard link of a library file
+	// already exists in library, so hard links must be kept.
+	scanner.SetSizeFilter(getFileSizes(source))
+	scanner.SetKeepHardLinks(true)
+
+	if err := scanner.Scan(); err != nil {
+		return 1
+	}
+
+	// Device and inode numbers of library files,
+	// source folder might be in library.
+	libraryIds := getScannedFileIds(scanner, library, source)
+
+	// Result variables
+	var copiedFiles int = 0
+	var copiedBytes int64 = 0
+	var skippedFiles int = 0
+
+	// Files copied this time, including duplicated ones in source folder.
+	copied := make(map[SHA256Digest]bool)
+
+	// Target paths (only for list mode).
+	reserved := make(map[string]bool)
+
+	updater.Log(LOG_INFO, "<Ingested Files>")
+
+	for _, file := range getSortedScannedFiles(scanner) {
+		// Check if it's a source file.
+		if !SameOrIsChild(source, file.Path) {
+			continue
+		}
+
+		// Check if it's a hard link of a library file,
+		// or the same content exists in library.
+		exists := copied[file.SHA256] || libraryIds[file.Id]
+		for _, item := range scanner.GetScannedFiles()[file.SHA256] {
+			// Check file size here to avoid hash collision.
+			if !exists && item.Size == file.Size &&
+				SameOrIsChild(library, item.Path) && !SameOrIsChild(source, item.Path) {
+				exists = true
+			}
+		}
+
+		if exists {
+			updater.Log(LOG_TRACE, "%v already exists in library.", file.Path)
+			skippedFiles++
+			continue
+		}
+
+		// Get target path.
+		relPath := GetRelativePath([]string{source}, file.Path)
+		target, err := expandTemplate(options.template, options.folder, file, relPath)
+		if err != nil {
+			updater.IncreaseErrors()
+			updater.Log(LOG_ERROR, "Could not get target path of %v (%v).", file.Path, err)
+			continue
+		}
+
+		target = GetUnusedPath(target, reserved)
+
+		if options.list {
+			reserved[GetPathAsKey(target)] = true
+		} else if err := CopyFile(file.Path, target); err != nil {
+			updater.IncreaseErrors()
+			updater.Log(LOG_ERROR, "Could not copy %v to %v (%v).", file.Path, target, err)
+			continue
+		}
+
+		updater.Log(LOG_INFO, "%v -> %v", file.Path, target)
+		copied[file.SHA256] = true
+		copiedFiles++
+		copiedBytes += file.Size
+	}
+
+	// Update local cache.
+	scanner.SaveCache()
+
+	updater.Log(LOG_INFO, "")
+	logScanSummary(scanner, updater)
+
+	if options.list {
+		updater.Log(LOG_INFO, "New Files:        %v", copiedFiles)
+		updater.Log(LOG_INFO, "New Size:         %.3f MB", float64(copiedBytes)/(1024*1024))
+	} else {
+		updater.Log(LOG_INFO, "Copied Files:     %v", copiedFiles)
+		updater.Log(LOG_INFO, "Copied Size:      %.3f MB", float64(copiedBytes)/(1024*1024))
+	}
+
+	updater.Log(LOG_INFO, "Existing Files:   %v", skippedFiles)
+
+	if updater.Errors() > 0 {
+		updater.Log(LOG_INFO, "Errors:           %v", updater.Errors())
+	}
+
+	return 0
+}
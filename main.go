@@ -30,7 +30,8 @@ func usage() {
 	fmt.Println("Copyright 2015 (C) Alex Jin (toalexjin@hotmail.com)")
 	fmt.Println("Remove duplicated files from your system.")
 	fmt.Println()
-	fmt.Println("Usage: dedup [-v] [-f] [-l] [-i <TYPE>,...] [-e <TYPE>,...] [-p <POLICY>,...] <path>...")
+	fmt.Println("Usage: dedup [-v] [-f] [-l] [-i <TYPE>,...] [-e <TYPE>,...] [-p <POLICY>,...] [-sniff] [-x <GLOB>,...] [-xr <REGEX>] [-ix <GLOB>,...] [-ixr <REGEX>] [-gitignore] [-xattr <MODE>] [-paranoid] [-sort <ORDER>] [-explain] [-keep <N>] [-distinct <WHAT>] <path>...")
+	fmt.Println("       dedup <COMMAND> [<args>...]")
 	fmt.Println()
 	fmt.Println("Options and Arguments:")
 	fmt.Println("    -v:        Verbose mode.")
@@ -39,16 +40,55 @@ func usage() {
 	fmt.Println("    -i:        Include filters (Scan & remove specified files only).")
 	fmt.Println("    -e:        Exclude filters (Do NOT scan & remove specified files).")
 	fmt.Println("    -p:        When duplication happens, which file will be removed.")
+	fmt.Println("    -sniff:    Detect types of files by content, instead of extensions.")
+	fmt.Println("    -x:        Exclude files and folders matching glob patterns.")
+	fmt.Println("    -xr:       Exclude files and folders matching a regular expression.")
+	fmt.Println("    -ix:       Include files matching glob patterns.")
+	fmt.Println("    -ixr:      Include files matching a regular expression.")
+	fmt.Println("    -gitignore: Honor .gitignore files as well as .dedupignore.")
+	fmt.Println("    -xattr:    Save file hashes in extended attributes (Linux only).")
+	fmt.Println("    -paranoid: Compare file content byte by byte before removing files.")
+	fmt.Println("    -sort:     Order of duplicated groups.")
+	fmt.Println("    -explain:  Explain which policy item decided the rank of each file.")
+	fmt.Println("    -keep:     Number of files to keep in each group (default 1).")
+	fmt.Println("    -distinct: Prefer kept files on distinct devices or roots.")
 	fmt.Println()
 	fmt.Println("-i <TYPE>, -e <TYPE>:")
 	fmt.Println("    audio:     Audio files.")
 	fmt.Println("    office:    Microsoft Office documents.")
-	fmt.Println("    photo:     Photo (picture) files.")
+	fmt.Println("    photo:     Photo (picture) files, e.g. JPEG, HEIC, WebP.")
+	fmt.Println("    raw:       Raw camera files, e.g. CR2, NEF, ARW, DNG.")
 	fmt.Println("    video:     Video files.")
+	fmt.Println("    document:  PDF, ePub and other e-book files.")
+	fmt.Println("    source:    Source code files.")
 	fmt.Println("    package:   Tarball, compressed, ISO, installation packages, etc.")
+	fmt.Println("    .<EXT>:    Files with the extention, e.g. \".tar.zst\".")
 	fmt.Println()
 	fmt.Println("    Remark: If both include and exclude filters are not set,")
 	fmt.Println("            then all files will be scanned.")
+	fmt.Println("            Extentions might have multiple parts, the longest")
+	fmt.Println("            matched one wins, e.g. \"-i package -e .gz\" scans")
+	fmt.Println("            \"a.tar.gz\" but skips \"a.gz\".")
+	fmt.Println("            More types could be defined in config file, see below.")
+	fmt.Println("            With \"-sniff\", files are classified by magic bytes, e.g.")
+	fmt.Println("            \"IMG_1234\" and \".dat\" files, or a photo named \"a.zip\".")
+	fmt.Println("            Extentions still decide if content is unknown or shared")
+	fmt.Println("            by the type of the extention (e.g. \".cr2\" is TIFF).")
+	fmt.Println()
+	fmt.Println("-x <GLOB>, -xr <REGEX>, -ix <GLOB>, -ixr <REGEX>:")
+	fmt.Println("    Patterns match full paths separated by \"/\", e.g.")
+	fmt.Println("    \"-x node_modules,.git,Thumbs.db\", \"-xr /\\.cache/\", \"-ix **/DCIM/**\".")
+	fmt.Println("    \"**\" matches any characters, \"*\" and \"?\" do not match \"/\".")
+	fmt.Println("    Globs not starting with \"/\" or \"**\" match the end of paths.")
+	fmt.Println()
+	fmt.Println("    Remark: Excluded folders are not scanned at all. Exclude patterns")
+	fmt.Println("            win over include patterns, and path filters work")
+	fmt.Println("            together with type filters (-i, -e).")
+	fmt.Println()
+	fmt.Println(".dedupignore:")
+	fmt.Println("    Files and folders matching patterns of \".dedupignore\" files (same")
+	fmt.Println("    syntax as \".gitignore\") are not scanned. Patterns apply to the")
+	fmt.Println("    folder containing the file and its sub-folders, deeper files win.")
 	fmt.Println()
 	fmt.Println("-p <POLICY>:")
 	fmt.Println("    longname:  Remove duplicated files with longer file name.")
@@ -57,9 +97,104 @@ func usage() {
 	fmt.Println("    shortpath: Remove duplicated files with shorter full path.")
 	fmt.Println("    new:       Remove duplicated files with newer last modification time.")
 	fmt.Println("    old:       Remove duplicated files with older last modification time.")
+	fmt.Println("    shallow:   Remove duplicated files with fewer parent folders.")
+	fmt.Println("    deep:      Remove duplicated files with more parent folders.")
+	fmt.Println("    newchange: Remove duplicated files with newer last change time.")
+	fmt.Println("    oldchange: Remove duplicated files with older last change time.")
+	fmt.Println("    newbirth:  Remove duplicated files with newer creation (birth) time.")
+	fmt.Println("    oldbirth:  Remove duplicated files with older creation (birth) time.")
+	fmt.Println("    fewlinks:  Remove duplicated files with fewer hard links.")
+	fmt.Println("    manylinks: Remove duplicated files with more hard links.")
+	fmt.Println("    readonly:  Remove read-only duplicated files.")
+	fmt.Println("    writable:  Remove writable duplicated files.")
+	fmt.Println("    owner=<USER>,..., group=<GROUP>,...:")
+	fmt.Println("               Keep duplicated files owned by specified users (or groups),")
+	fmt.Println("               earlier-listed users (or groups) win.")
+	fmt.Println("    root-order: Keep duplicated files under the earliest-listed <path>.")
+	fmt.Println("    copyname:  Remove duplicated files whose names have copy markers,")
+	fmt.Println("               e.g. \"Copy of X\", \"X - Copy\", \"X (1)\", \"X_copy\", \"X.bak\", \"X~\".")
+	fmt.Println("    copyname=<PATTERN>,...:")
+	fmt.Println("               The same as \"copyname\" but with specified copy markers,")
+	fmt.Println("               \"*\" is the original name and \"#\" is a counter")
+	fmt.Println("               of 1 or 2 digits, e.g. \"X (2020)\" is not a copy.")
+	fmt.Println("    prefer=<FOLDER>,...:")
+	fmt.Println("               Keep duplicated files under preferred folders,")
+	fmt.Println("               earlier-listed folders win.")
+	fmt.Println("    keep:glob=<GLOB>,..., delete:glob=<GLOB>,...:")
+	fmt.Println("               Keep (or remove) files whose full paths match glob patterns,")
+	fmt.Println("               e.g. \"keep:glob=**/Originals/**\".")
+	fmt.Println("    keep:regex=<REGEX>, delete:regex=<REGEX>:")
+	fmt.Println("               Keep (or remove) files whose full paths match a regular")
+	fmt.Println("               expression, e.g. \"delete:regex=/tmp/|/Downloads/\".")
+	fmt.Println("    keep:ext=<EXT>,..., delete:ext=<EXT>,...:")
+	fmt.Println("               Keep (or remove) files with specified extensions,")
+	fmt.Println("               e.g. \"keep:ext=.raw\".")
+	fmt.Println("    <CLAUSE> then <CLAUSE> ...:")
+	fmt.Println("               Policy expression, clauses are evaluated in order,")
+	fmt.Println("               e.g. 'prefer(path =~ \"^/archive/\") then older(mtime)'.")
+	fmt.Println()
+	fmt.Println("    Clauses:   prefer(<COND>), avoid(<COND>),")
+	fmt.Println("               older(<TIME>), newer(<TIME>): mtime, ctime, btime")
+	fmt.Println("               shorter(<TEXT>), longer(<TEXT>): path, dir, name, ext")
+	fmt.Println("               smaller(<NUMBER>), larger(<NUMBER>): size, depth, root,")
+	fmt.Println("               links, uid, gid")
+	fmt.Println("    Conditions: <FIELD> <OP> <VALUE>, \"writable\", \"and\", \"or\", \"not\",")
+	fmt.Println("               e.g. 'name =~ \"(?i)^img_\" and size >= 10m',")
+	fmt.Println("               'mtime < \"2020-01-31\"'. Operators: == != < <= > >= =~ !~")
+	fmt.Println()
+	fmt.Println("    exec:<PROGRAM> [<ARG>...]:")
+	fmt.Println("               Send each duplicated group as JSON to the program (stdin),")
+	fmt.Println("               which writes back index of the file to keep, e.g. 2,")
+	fmt.Println("               or decision of each file, e.g. [\"keep\",\"delete\"].")
+	fmt.Println("               Arguments are separated by spaces, e.g. \"exec:python3 a.py\".")
+	fmt.Println("               If it fails or does not answer in 30 seconds, all files")
+	fmt.Println("               of the group are kept.")
+	fmt.Println("               It could not be combined with other policy items.")
 	fmt.Println()
 	fmt.Println("    Remark: If \"-p <POLICY>\" is not set, then default policy")
 	fmt.Println("            \"longname,longpath,new\" will be used.")
+	fmt.Println("            Keep and delete rules are evaluated in order")
+	fmt.Println("            before all other policy items. If no policy item")
+	fmt.Println("            could decide, then the lexically smaller path is kept.")
+	fmt.Println("            Duplicated files are listed by rank, the best one first.")
+	fmt.Println()
+	fmt.Println("-sort <ORDER>:")
+	fmt.Println("    path:      Sort by path of the file to keep (default).")
+	fmt.Println("    wasted:    Groups with more wasted bytes come first.")
+	fmt.Println("    size:      Groups with larger files come first.")
+	fmt.Println("    hash:      Sort by SHA256 hash.")
+	fmt.Println()
+	fmt.Println("-distinct <WHAT>:")
+	fmt.Println("    device:    Prefer kept files on distinct devices.")
+	fmt.Println("    root:      Prefer kept files under distinct command line paths.")
+	fmt.Println()
+	fmt.Println("-xattr <MODE>:")
+	fmt.Println("    off:       Do not use extended attributes (default).")
+	fmt.Println("    on:        Use extended attributes in addition to cache file.")
+	fmt.Println("    only:      Use extended attributes instead of cache file.")
+	fmt.Println()
+	fmt.Println("    Remark: File hashes saved in extended attributes follow files")
+	fmt.Println("            when they are renamed or moved. If extended attributes")
+	fmt.Println("            are not supported, then they are ignored silently.")
+	fmt.Println("            With \"on\", cache entries (having last change time)")
+	fmt.Println("            win, extended attributes are used for files not in cache.")
+	fmt.Println()
+	fmt.Println("Config file ($HOME/.dedup/config):")
+	fmt.Println("    [types]           Define (\"=\") or extend (\"+=\") file types,")
+	fmt.Println("                      e.g. \"raw = .cr2,.nef\", \"photo += .jxl\".")
+	fmt.Println("    [flags]           Default flags of all commands, e.g. \"sniff = true\".")
+	fmt.Println("    [flags.<COMMAND>] Default flags of a command, e.g. [flags.verify].")
+	fmt.Println()
+	fmt.Println("<COMMAND>:")
+	fmt.Println("    manifest:         Write a manifest (relative path, size, hash) of files.")
+	fmt.Println("    compare-manifest: Remove (or list) files that exist in a manifest.")
+	fmt.Println("    find:             Find all copies of specified files.")
+	fmt.Println("    unique:           List files that have no copy in other paths.")
+	fmt.Println("    ingest:           Copy files that do not exist in a library yet.")
+	fmt.Println("    merge:            Move files to another folder, skip duplicated ones.")
+	fmt.Println("    verify:           Report (or restore) files that do not match saved hashes.")
+	fmt.Println()
+	fmt.Println("    Remark: Run \"dedup <COMMAND>\" to get help of a command.")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("    > dedup -l d:\\data e:\\data")
@@ -72,6 +207,9 @@ func usage() {
 
 // Input paths might be relative and duplicated,
 // we need to convert to absolute paths and remove duplicated.
+//
+// Order of input paths is kept, so the index of a returned
+// path is its priority for policy "root-order".
 func getAbsUniquePaths(paths []string) ([]string, error) {
 
 	// For storing unique paths.
@@ -114,57 +252,148 @@ func getAbsUniquePaths(paths []string) ([]string, error) {
 	return uniquePaths, nil
 }
 
-func showDuplicatedFiles(files []*FileAttr) {
-	fmt.Printf("* 1) %v\n", files[0].Path)
+// Compare duplicated files byte by byte, saved hashes are not trusted.
+//
+// Each group is split into subsets of the same content, a file is
+// compared with the first one of each subset. Subsets having only one
+// file are dropped, and saved hashes of files which are different from
+// the first one of the group are invalidated, so they will be calculated
+// again next time. Files keep their order in subsets.
+func verifyDuplicatedGroups(groups [][]*FileAttr,
+	scanner FileScanner, updater Updater) [][]*FileAttr {
+
+	result := make([][]*FileAttr, 0, len(groups))
+
+	for _, files := range groups {
+		var subsets [][]*FileAttr
+
+		for _, file := range files {
+			// Index of the subset having the same content.
+			index := -1
+			failed := false
+
+			for i := 0; i < len(subsets) && index == -1 && !failed; i++ {
+				same, err := SameContent(subsets[i][0].Path, file.Path)
+				if err != nil {
+					updater.IncreaseErrors()
+					updater.Log(LOG_ERROR, "Could not compare %v with %v (%v).",
+						file.Path, subsets[i][0].Path, err)
+					failed = true
+				} else if same {
+					index = i
+				}
+			}
+
+			if failed {
+				continue
+			}
+
+			if index >= 0 {
+				subsets[index] = append(subsets[index], file)
+				continue
+			}
+
+			if len(subsets) > 0 {
+				updater.Log(LOG_WARN, "%v is different from %v, saved hash is stale.",
+					file.Path, files[0].Path)
+				scanner.OnFileChanged(files[0])
+				scanner.OnFileChanged(file)
+			}
+
+			subsets = append(subsets, []*FileAttr{file})
+		}
+
+		for _, subset := range subsets {
+			if len(subset) > 1 {
+				result = append(result, subset)
+			}
+		}
+	}
+
+	return result
+}
+
+// Files in range [0,keep) are marked with "*".
+func showDuplicatedFiles(files []*FileAttr, keep int) {
+	for i := 0; i < len(files); i++ {
+		if i < keep {
+			fmt.Printf("* %v) %v\n", i+1, files[i].Path)
+		} else {
+			fmt.Printf("  %v) %v\n", i+1, files[i].Path)
+		}
+	}
+}
+
+func showExplanation(policy Policy, files []*FileAttr) {
+	for _, line := range policy.Explain(files) {
+		fmt.Printf("  # %v\n", line)
+	}
+}
+
+// Parse file indexes to keep, e.g. "1,3".
+//
+// If succeeded, files to keep are moved to the beginning
+// of slice "files", and the number of them is returned.
+func parseKeepIndexes(files []*FileAttr, line string) (int, bool) {
+	kept := make([]*FileAttr, 0, len(files))
+	selected := make(map[int]bool)
+
+	for _, token := range strings.Split(line, ",") {
+		index, err := strconv.Atoi(strings.TrimSpace(token))
+		if err != nil || index < 1 || index > len(files) || selected[index-1] {
+			return 0, false
+		}
+
+		selected[index-1] = true
+		kept = append(kept, files[index-1])
+	}
 
-	for i := 1; i < len(files); i++ {
-		fmt.Printf("  %v) %v\n", i+1, files[i].Path)
+	for i, file := range files {
+		if !selected[i] {
+			kept = append(kept, file)
+		}
 	}
+
+	copy(files, kept)
+	return len(selected), true
 }
 
-// Return value is PROMPT_ANSWER_???
+// Return value is PROMPT_ANSWER_??? and the number of files to keep.
 //
 // Note that this function might modify input slice "files".
 // If return value is PROMPT_ANSWER_YES or PROMPT_ANSWER_CONTINUE,
-// the first file of slice "files" needs to keep and the rest
+// files in range [0,keep) need to keep and the rest
 // of files could be removed.
-func promptKeep(files []*FileAttr) int {
+func promptKeep(files []*FileAttr, keep int) (int, int) {
 
 	// Create a buffered reader.
 	reader := bufio.NewReader(os.Stdin)
 
 	for {
 		// Print duplicated files.
-		showDuplicatedFiles(files)
+		showDuplicatedFiles(files, keep)
 
-		fmt.Printf("Which file do you want to keep? (1-%v,Skip,Continue,Quit):", len(files))
+		fmt.Printf("Which files do you want to keep? (1-%v[,...],Skip,Continue,Quit):", len(files))
 		if line, _, err := reader.ReadLine(); err == nil {
 			cmd := strings.ToLower(string(line))
 
 			switch cmd {
 			case "s", "skip":
-				return PROMPT_ANSWER_SKIP
+				return PROMPT_ANSWER_SKIP, keep
 
 			case "c", "continue":
-				return PROMPT_ANSWER_CONTINUE
+				return PROMPT_ANSWER_CONTINUE, keep
 
 			case "q", "quit":
-				return PROMPT_ANSWER_QUIT
+				return PROMPT_ANSWER_QUIT, keep
 
 			default:
 				if len(line) > 0 {
-					index, err := strconv.Atoi(cmd)
-					if err != nil || index < 1 || index > len(files) {
-						fmt.Fprintf(os.Stderr, "Invalid Command: %v\n\n", string(line))
-					} else {
-						if index != 1 {
-							tmp := files[0]
-							files[0] = files[index-1]
-							files[index-1] = tmp
-						}
-
-						return PROMPT_ANSWER_YES
+					if count, ok := parseKeepIndexes(files, cmd); ok {
+						return PROMPT_ANSWER_YES, count
 					}
+
+					fmt.Fprintf(os.Stderr, "Invalid Command: %v\n\n", string(line))
 				} else {
 					fmt.Println()
 				}
@@ -173,23 +402,48 @@ func promptKeep(files []*FileAttr) int {
 	}
 }
 
+// Command line options of "dedup".
+type mainOptions struct {
+	scanOptions
+	force        bool
+	list         bool
+	policySpec   string
+	paranoid     bool
+	orderSpec    string
+	explain      bool
+	keep         int
+	distinctSpec string
+}
+
+// Register flags of "dedup" to a flag set.
+func (me *mainOptions) addFlags(flags *flag.FlagSet) {
+	me.scanOptions.addFlags(flags)
+	flags.BoolVar(&me.force, "f", false, "Do not prompt before removing files.")
+	flags.BoolVar(&me.list, "l", false, "List duplicated files only, do not remove them.")
+	flags.StringVar(&me.policySpec, "p", "", "When duplication happens, which file will be removed.")
+	flags.BoolVar(&me.paranoid, "paranoid", false, "Compare file content byte by byte before removing files.")
+	flags.StringVar(&me.orderSpec, "sort", "", "Order of duplicated groups.")
+	flags.BoolVar(&me.explain, "explain", false, "Explain which policy item decided the rank of each file.")
+	flags.IntVar(&me.keep, "keep", 1, "Number of files to keep in each group.")
+	flags.StringVar(&me.distinctSpec, "distinct", "", "Prefer kept files on distinct devices or roots.")
+}
+
 func main_i() int {
 
-	var verbose bool
-	var force bool
-	var list bool
-	var includes string
-	var excludes string
-	var policySpec string
+	// Run sub-command if it's specified.
+	if len(os.Args) > 1 {
+		if command, ok := commandMapping[os.Args[1]]; ok {
+			return command(os.Args[2:])
+		}
+	}
+
+	var options mainOptions
 
 	// Parse command line options.
-	flag.BoolVar(&verbose, "v", false, "Verbose mode.")
-	flag.BoolVar(&force, "f", false, "Do not prompt before removing files.")
-	flag.BoolVar(&list, "l", false, "List duplicated files only, do not remove them.")
-	flag.StringVar(&includes, "i", "", "Include filters.")
-	flag.StringVar(&excludes, "e", "", "Exclude filters.")
-	flag.StringVar(&policySpec, "p", "", "When duplication happens, which file will be removed.")
-	flag.Parse()
+	options.addFlags(flag.CommandLine)
+	if err := parseFlags(flag.CommandLine, "", os.Args[1:]); err != nil {
+		return 1
+	}
 
 	// If argument is missing, then exit.
 	if flag.NArg() == 0 {
@@ -199,36 +453,34 @@ func main_i() int {
 
 	// Create policy object to determine
 	// which file to delete when duplication happens.
-	policy, err := NewPolicy(policySpec)
+	policy, err := NewPolicy(options.policySpec)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		return 1
 	}
 
-	// Create filter object.
-	filter, err := NewFilter(includes, excludes)
+	// Order of duplicated groups.
+	order, err := ParseGroupOrder(options.orderSpec)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		return 1
 	}
 
-	// Convert input paths to absolute.
-	paths, err := getAbsUniquePaths(flag.Args())
-	if err != nil {
+	// Number of files to keep.
+	if options.keep < 1 {
+		fmt.Fprintf(os.Stderr, "%v\n", ErrInvalidKeepCount)
 		return 1
 	}
 
-	// Create status updater.
-	updater := NewUpdater(verbose)
-
-	// Create file scanner.
-	scanner := NewFileScanner(paths, filter, updater)
-
-	// Ignore error because cache is not very important.
-	scanner.ReadCache()
+	distinct, err := ParseKeepDistinct(options.distinctSpec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
 
 	// Scan files.
-	if err := scanner.Scan(); err != nil {
+	scanner, updater, err := options.scan(flag.Args())
+	if err != nil {
 		return 1
 	}
 
@@ -237,10 +489,21 @@ func main_i() int {
 	var deletedBytes int64 = 0
 	var first_duplication = true
 
-	// Iterate all scanned files.
-	for _, item := range scanner.GetScannedFiles() {
-		// If no duplicated files, then skip.
-		if len(item) <= 1 {
+	// Do not trust saved hashes, compare file content.
+	groups := GetDuplicatedGroups(scanner, policy, order)
+	if options.paranoid {
+		groups = verifyDuplicatedGroups(groups, scanner, updater)
+	}
+
+	// Iterate all duplicated files, item[0] is the best one.
+	for _, item := range groups {
+		// Files in range [0,kept) need to keep
+		// and the rest could be removed.
+		kept := policy.GetKeepCount(item)
+		if kept == 0 {
+			kept = SelectKeepers(item, options.keep, distinct)
+		}
+		if kept >= len(item) {
 			continue
 		}
 
@@ -248,51 +511,48 @@ func main_i() int {
 			first_duplication = false
 			updater.Log(LOG_INFO, "<Duplicated Files>")
 		} else {
-			if !list && !force {
+			if !options.list && !options.force {
 				updater.Log(LOG_INFO, "")
 			}
 		}
 
-		// Once returned, item[0] needs to keep
-		// and the rest could be removed.
-		policy.Sort(item)
+		if options.list {
+			showDuplicatedFiles(item, kept)
 
-		if list {
-			showDuplicatedFiles(item)
+			if options.explain {
+				showExplanation(policy, item)
+			}
 
-			deletedFiles += len(item) - 1
-			for i := 1; i < len(item); i++ {
+			deletedFiles += len(item) - kept
+			for i := kept; i < len(item); i++ {
 				deletedBytes += item[i].Size
 			}
 		} else {
-			if !force {
+			if options.explain {
+				showExplanation(policy, item)
+			}
+
+			if !options.force {
 				// Prompt before remove file.
-				if result := promptKeep(item); result == PROMPT_ANSWER_SKIP {
+				result, count := promptKeep(item, kept)
+				kept = count
+
+				if result == PROMPT_ANSWER_SKIP {
 					continue
 				} else if result == PROMPT_ANSWER_QUIT {
 					scanner.SaveCache()
 					return 1
 				} else if result == PROMPT_ANSWER_CONTINUE {
-					force = true
+					options.force = true
 				}
 			}
 
-			// Delete duplicated files, range [1,len).
-			for i := 1; i < len(item); i++ {
-				if err := os.Remove(item[i].Path); err != nil {
-					updater.IncreaseErrors()
-					updater.Log(LOG_ERROR, "Could not delete file %v (%v).",
-						item[i].Path, err)
-					continue
+			// Delete duplicated files, range [kept,len).
+			for i := kept; i < len(item); i++ {
+				if removeFile(item[i], scanner, updater) {
+					deletedBytes += item[i].Size
+					deletedFiles++
 				}
-
-				// Write log and update file count.
-				updater.Log(LOG_INFO, "%v was deleted.", item[i].Path)
-				deletedBytes += item[i].Size
-				deletedFiles++
-
-				// Update cache file.
-				scanner.OnFileRemoved(item[i])
 			}
 		}
 	}
@@ -304,12 +564,9 @@ func main_i() int {
 		updater.Log(LOG_INFO, "")
 	}
 
-	updater.Log(LOG_INFO, "<Summary>")
-	updater.Log(LOG_INFO, "Total Files:      %v", scanner.GetTotalFiles())
-	updater.Log(LOG_INFO, "Total Folders:    %v", scanner.GetTotalFolders())
-	updater.Log(LOG_INFO, "Total Size:       %.3f MB", float64(scanner.GetTotalBytes())/(1024*1024))
+	logScanSummary(scanner, updater)
 
-	if list {
+	if options.list {
 		updater.Log(LOG_INFO, "Duplicated Files: %v", deletedFiles)
 		updater.Log(LOG_INFO, "Duplicated Size:  %.3f MB", float64(deletedBytes)/(1024*1024))
 	} else {
@@ -0,0 +1,62 @@
+// File deduplication
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDuplicatedGroups(t *testing.T) {
+	root := t.TempDir()
+
+	// Files with the same first letter have the same content.
+	newFiles := func(names ...string) []*FileAttr {
+		files := make([]*FileAttr, 0, len(names))
+
+		for _, name := range names {
+			path := filepath.Join(root, name)
+			if err := os.WriteFile(path, []byte(name[0:1]), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			files = append(files, &FileAttr{Path: path, Name: name})
+		}
+
+		return files
+	}
+
+	tests := []struct {
+		files []*FileAttr
+		want  string
+	}{
+		{newFiles("a1", "a2", "a3"), "a1,a2,a3"},
+		{newFiles("b1", "c1", "b2", "c2", "d1"), "b1,b2 c1,c2"},
+		{newFiles("e1", "f1", "g1"), ""},
+		{append(newFiles("h1", "h2"), &FileAttr{Path: filepath.Join(root, "missing")}), "h1,h2"},
+	}
+
+	filter, err := NewFilter("", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := NewFileScanner([]string{root}, filter, NewUpdater(false), XATTR_MODE_OFF)
+
+	for _, test := range tests {
+		var subsets []string
+		for _, subset := range verifyDuplicatedGroups([][]*FileAttr{test.files}, scanner, NewUpdater(false)) {
+			var names []string
+			for _, file := range subset {
+				names = append(names, file.Name)
+			}
+
+			subsets = append(subsets, strings.Join(names, ","))
+		}
+
+		if result := strings.Join(subsets, " "); result != test.want {
+			t.Errorf("verifyDuplicatedGroups() = %q, want %q", result, test.want)
+		}
+	}
+}
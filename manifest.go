@@ -0,0 +1,426 @@
+// File deduplication
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// First line of manifest files.
+const MANIFEST_HEADER = "# dedup manifest"
+
+// Manifest entry.
+//
+// A manifest is a portable list of files, it does not
+// depend on where the files are located (or mounted).
+type ManifestEntry struct {
+	Path   string       // Relative path, separated by "/".
+	Size   int64        // File size, -1 means unknown.
+	SHA256 SHA256Digest // SHA256 checksum.
+}
+
+// Like sha256sum, if the path has "\", new lines or carriage
+// returns, then they are escaped and the line starts with "\".
+func (me *ManifestEntry) String() string {
+	if path, escaped := escapeSHA256SumPath(me.Path); escaped {
+		return fmt.Sprintf("\\%v|%v|%v", &me.SHA256, me.Size, path)
+	}
+
+	return fmt.Sprintf("%v|%v|%v", &me.SHA256, me.Size, me.Path)
+}
+
+// Parse SHA256 hash in hex format.
+func parseSHA256(str string) (SHA256Digest, bool) {
+	var digest SHA256Digest
+
+	if value, err := hex.DecodeString(str); err != nil || len(value) != sha256.Size {
+		return digest, false
+	} else {
+		copy(digest[:], value)
+	}
+
+	return digest, true
+}
+
+// Escape a file name like sha256sum, return false
+// if there is nothing to escape.
+func escapeSHA256SumPath(path string) (string, bool) {
+	if !strings.ContainsAny(path, "\\\n\r") {
+		return path, false
+	}
+
+	replacer := strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+	return replacer.Replace(path), true
+}
+
+// Unescape a file name of sha256sum, "\\" is "\",
+// "\n" is a new line and "\r" is a carriage return.
+func unescapeSHA256SumPath(path string) (string, bool) {
+	var builder strings.Builder
+
+	for i := 0; i < len(path); i++ {
+		if path[i] != '\\' {
+			builder.WriteByte(path[i])
+			continue
+		}
+
+		if i+1 == len(path) {
+			return "", false
+		}
+
+		i++
+		switch path[i] {
+		case '\\':
+			builder.WriteByte('\\')
+
+		case 'n':
+			builder.WriteByte('\n')
+
+		case 'r':
+			builder.WriteByte('\r')
+
+		default:
+			return "", false
+		}
+	}
+
+	return builder.String(), true
+}
+
+// Parse a line of manifest file.
+//
+// The following formats are supported:
+// 1) sha256sum (GNU): "<sha256>  <path>" or "<sha256> *<path>"
+// 2) sha256sum (BSD): "SHA256 (<path>) = <sha256>"
+// 3) dedup manifest: "<sha256>|<size>|<path>"
+//
+// sha256sum formats are checked first, because their paths
+// might contain "|". If a path has special characters (in any
+// format), then it's escaped and the line starts with "\".
+func parseManifestLine(line string) (*ManifestEntry, bool) {
+	entry := &ManifestEntry{Size: -1}
+	var ok bool
+
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+
+	size := sha256.Size * 2
+
+	if len(line) > size+2 && line[size] == ' ' &&
+		(line[size+1] == ' ' || line[size+1] == '*') {
+		// sha256sum
+		if entry.SHA256, ok = parseSHA256(line[0:size]); !ok {
+			return nil, false
+		}
+
+		entry.Path = line[size+2:]
+	} else if strings.HasPrefix(line, "SHA256 (") {
+		// sha256sum --tag
+		index := strings.LastIndex(line, ") = ")
+		if index == -1 {
+			return nil, false
+		}
+
+		if entry.SHA256, ok = parseSHA256(line[index+4:]); !ok {
+			return nil, false
+		}
+
+		entry.Path = line[len("SHA256 ("):index]
+	} else if fields := strings.SplitN(line, "|", 3); len(fields) == 3 {
+		// dedup manifest.
+		if entry.SHA256, ok = parseSHA256(fields[0]); !ok {
+			return nil, false
+		}
+
+		if number, err := strconv.ParseInt(fields[1], 10, 64); err != nil || number < 0 {
+			return nil, false
+		} else {
+			entry.Size = number
+		}
+
+		entry.Path = fields[2]
+	} else {
+		return nil, false
+	}
+
+	if escaped {
+		if entry.Path, ok = unescapeSHA256SumPath(entry.Path); !ok {
+			return nil, false
+		}
+	}
+
+	if len(entry.Path) == 0 {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// Read a manifest file.
+func ReadManifest(path string) ([]*ManifestEntry, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	entries := make([]*ManifestEntry, 0, 1024)
+
+	// Create a buffered reader to enhance read performance.
+	reader := bufio.NewReader(fp)
+
+	for number := 1; ; number++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		// Skip empty lines and comments.
+		if str := strings.TrimRight(line, "\r\n"); len(str) > 0 && str[0] != '#' {
+			if entry, ok := parseManifestLine(str); ok {
+				entries = append(entries, entry)
+			} else {
+				return nil, fmt.Errorf("%v (%v, line %v)",
+					ErrInvalidManifestFile, path, number)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+// Save a manifest file.
+func SaveManifest(path string, entries []*ManifestEntry) error {
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	// Create a buffered writer to enhance performance.
+	writer := bufio.NewWriter(fp)
+
+	if _, err := writer.WriteString(MANIFEST_HEADER + "\n"); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if _, err := writer.WriteString(entry.String() + "\n"); err != nil {
+			return err
+		}
+	}
+
+	// If it's a buffered writer, we need to flush data to disk.
+	return writer.Flush()
+}
+
+func usageManifest() {
+	fmt.Println("Usage: dedup manifest [-v] [-i <TYPE>,...] [-e <TYPE>,...] [-sniff] [-x <GLOB>,...] [-xr <REGEX>] [-ix <GLOB>,...] [-ixr <REGEX>] [-gitignore] [-xattr <MODE>] -o <file> <path>...")
+	fmt.Println("       dedup compare-manifest [-v] [-f] [-l] [-i <TYPE>,...] [-e <TYPE>,...] [-sniff] [-x <GLOB>,...] [-xr <REGEX>] [-ix <GLOB>,...] [-ixr <REGEX>] [-gitignore] [-xattr <MODE>] <manifest> <path>...")
+	fmt.Println()
+	fmt.Println("manifest:           Write relative path, size and hash of scanned files to a manifest.")
+	fmt.Println("compare-manifest:   Remove (or list) files that exist in a manifest.")
+	fmt.Println()
+	fmt.Println("Options and Arguments:")
+	fmt.Println("    -o:        Manifest file to write.")
+	fmt.Println("    -f:        Do not prompt before removing each file.")
+	fmt.Println("    -l:        List files only, do not remove them.")
+	fmt.Println()
+	fmt.Println("    Remark: Output of \"sha256sum\" could be used as manifest as well.")
+	fmt.Println()
+}
+
+// Command line options of "dedup manifest".
+type manifestOptions struct {
+	scanOptions
+	output string
+}
+
+// Register flags of "dedup manifest" to a flag set.
+func (me *manifestOptions) addFlags(flags *flag.FlagSet) {
+	me.scanOptions.addFlags(flags)
+	flags.StringVar(&me.output, "o", "", "Manifest file to write.")
+}
+
+// "dedup manifest -o <file> <path>..."
+func mainManifest(args []string) int {
+	var options manifestOptions
+
+	// Parse command line options.
+	flags := flag.NewFlagSet("manifest", flag.ContinueOnError)
+	flags.Usage = usageManifest
+	options.addFlags(flags)
+	if err := parseFlags(flags, "manifest", args); err != nil {
+		return 1
+	}
+
+	// If argument is missing, then exit.
+	if flags.NArg() == 0 || len(options.output) == 0 {
+		usageManifest()
+		return 1
+	}
+
+	// Scan files.
+	scanner, updater, err := options.scan(flags.Args())
+	if err != nil {
+		return 1
+	}
+
+	// Update local cache.
+	scanner.SaveCache()
+
+	// Convert scanned files to manifest entries.
+	entries := make([]*ManifestEntry, 0, scanner.GetTotalFiles())
+	for _, file := range getSortedScannedFiles(scanner) {
+		entries = append(entries, &ManifestEntry{
+			Path:   GetRelativePath(scanner.GetPaths(), file.Path),
+			Size:   file.Size,
+			SHA256: file.SHA256,
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+
+	if err := SaveManifest(options.output, entries); err != nil {
+		updater.Log(LOG_ERROR, "Could not write manifest %v (%v).", options.output, err)
+		return 1
+	}
+
+	logScanSummary(scanner, updater)
+	updater.Log(LOG_INFO, "Manifest:         %v", options.output)
+
+	return 0
+}
+
+// Command line options of "dedup compare-manifest".
+type compareManifestOptions struct {
+	scanOptions
+	force bool
+	list  bool
+}
+
+// Register flags of "dedup compare-manifest" to a flag set.
+func (me *compareManifestOptions) addFlags(flags *flag.FlagSet) {
+	me.scanOptions.addFlags(flags)
+	flags.BoolVar(&me.force, "f", false, "Do not prompt before removing files.")
+	flags.BoolVar(&me.list, "l", false, "List files only, do not remove them.")
+}
+
+// "dedup compare-manifest <manifest> <path>..."
+func mainCompareManifest(args []string) int {
+	var options compareManifestOptions
+
+	// Parse command line options.
+	flags := flag.NewFlagSet("compare-manifest", flag.ContinueOnError)
+	flags.Usage = usageManifest
+	options.addFlags(flags)
+	if err := parseFlags(flags, "compare-manifest", args); err != nil {
+		return 1
+	}
+
+	// If argument is missing, then exit.
+	if flags.NArg() < 2 {
+		usageManifest()
+		return 1
+	}
+
+	// Read manifest file.
+	entries, err := ReadManifest(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	manifest := make(map[SHA256Digest]*ManifestEntry, len(entries))
+	for _, entry := range entries {
+		manifest[entry.SHA256] = entry
+	}
+
+	// Scan files.
+	scanner, updater, err := options.scan(flags.Args()[1:])
+	if err != nil {
+		return 1
+	}
+
+	// Result variables
+	var matchedFiles int = 0
+	var matchedBytes int64 = 0
+	var first_match = true
+
+	for _, file := range getSortedScannedFiles(scanner) {
+		// Check file size here to avoid hash collision.
+		entry, ok := manifest[file.SHA256]
+		if !ok || (entry.Size >= 0 && entry.Size != file.Size) {
+			continue
+		}
+
+		if first_match {
+			first_match = false
+			updater.Log(LOG_INFO, "<Files in Manifest>")
+		}
+
+		if options.list {
+			updater.Log(LOG_INFO, "%v (%v)", file.Path, entry.Path)
+			matchedFiles++
+			matchedBytes += file.Size
+			continue
+		}
+
+		if !options.force {
+			// Prompt before remove file.
+			updater.Log(LOG_INFO, "%v (%v)", file.Path, entry.Path)
+			if result := promptRemove(file); result == PROMPT_ANSWER_SKIP {
+				continue
+			} else if result == PROMPT_ANSWER_QUIT {
+				scanner.SaveCache()
+				return 1
+			} else if result == PROMPT_ANSWER_CONTINUE {
+				options.force = true
+			}
+		}
+
+		if removeFile(file, scanner, updater) {
+			matchedFiles++
+			matchedBytes += file.Size
+		}
+	}
+
+	// Update local cache.
+	scanner.SaveCache()
+
+	if !first_match {
+		updater.Log(LOG_INFO, "")
+	}
+
+	logScanSummary(scanner, updater)
+
+	if options.list {
+		updater.Log(LOG_INFO, "Matched Files:    %v", matchedFiles)
+		updater.Log(LOG_INFO, "Matched Size:     %.3f MB", float64(matchedBytes)/(1024*1024))
+	} else {
+		updater.Log(LOG_INFO, "Deleted Files:    %v", matchedFiles)
+		updater.Log(LOG_INFO, "Deleted Size:     %.3f MB", float64(matchedBytes)/(1024*1024))
+	}
+
+	if updater.Errors() > 0 {
+		updater.Log(LOG_INFO, "Errors:           %v", updater.Errors())
+	}
+
+	return 0
+}
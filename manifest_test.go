@@ -0,0 +1,124 @@
+// File deduplication
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func TestParseManifestLine(t *testing.T) {
+	tests := []struct {
+		line string
+		ok   bool
+		path string
+		size int64
+	}{
+		// dedup manifest.
+		{testSHA256 + "|0|a/b.txt", true, "a/b.txt", 0},
+		{testSHA256 + "|12|a|b.txt", true, "a|b.txt", 12},
+		{testSHA256 + "|-1|a.txt", false, "", 0},
+		{testSHA256 + "|x|a.txt", false, "", 0},
+		{testSHA256 + "|0|", false, "", 0},
+		{"1234|0|a.txt", false, "", 0},
+
+		// sha256sum (GNU).
+		{testSHA256 + "  a/b.txt", true, "a/b.txt", -1},
+		{testSHA256 + " *a/b.txt", true, "a/b.txt", -1},
+		{testSHA256 + "  a|b|c.txt", true, "a|b|c.txt", -1},
+		{testSHA256 + "  a b.txt", true, "a b.txt", -1},
+		{testSHA256 + " a.txt", false, "", 0},
+		{testSHA256 + "  ", false, "", 0},
+		{strings.ToUpper(testSHA256) + "  a.txt", true, "a.txt", -1},
+		{"zz" + testSHA256[2:] + "  a.txt", false, "", 0},
+
+		// Escaped file names.
+		{"\\" + testSHA256 + "  a\\\\b.txt", true, "a\\b.txt", -1},
+		{"\\" + testSHA256 + "  a\\nb.txt", true, "a\nb.txt", -1},
+		{"\\" + testSHA256 + "  a\\rb.txt", true, "a\rb.txt", -1},
+		{"\\" + testSHA256 + "  a\\xb.txt", false, "", 0},
+		{"\\" + testSHA256 + "  a\\", false, "", 0},
+		{testSHA256 + "  a\\\\b.txt", true, "a\\\\b.txt", -1},
+		{"\\" + testSHA256 + "|0|a\\nb.txt", true, "a\nb.txt", 0},
+		{"\\" + testSHA256 + "|0|a\\b.txt", false, "", 0},
+
+		// sha256sum (BSD).
+		{"SHA256 (a/b.txt) = " + testSHA256, true, "a/b.txt", -1},
+		{"SHA256 (a) = b.txt) = " + testSHA256, true, "a) = b.txt", -1},
+		{"\\SHA256 (a\\nb.txt) = " + testSHA256, true, "a\nb.txt", -1},
+		{"SHA256 (a.txt) " + testSHA256, false, "", 0},
+		{"SHA256 () = " + testSHA256, false, "", 0},
+
+		// Unknown formats.
+		{"a.txt", false, "", 0},
+		{"MD5 (a.txt) = d41d8cd98f00b204e9800998ecf8427e", false, "", 0},
+	}
+
+	for _, test := range tests {
+		entry, ok := parseManifestLine(test.line)
+		if ok != test.ok {
+			t.Errorf("parseManifestLine(%q) = %v, want %v", test.line, ok, test.ok)
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		if entry.Path != test.path || entry.Size != test.size {
+			t.Errorf("parseManifestLine(%q) = %q (%v bytes), want %q (%v bytes)",
+				test.line, entry.Path, entry.Size, test.path, test.size)
+		}
+
+		if entry.SHA256.String() != testSHA256 {
+			t.Errorf("parseManifestLine(%q) = %v, want %v", test.line, &entry.SHA256, testSHA256)
+		}
+	}
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.txt")
+
+	digest, _ := parseSHA256(testSHA256)
+	entries := []*ManifestEntry{
+		{Path: "a/b.txt", Size: 0, SHA256: digest},
+		{Path: "a|b c.txt", Size: 123, SHA256: digest},
+		{Path: "a\\b\nc\rd.txt", Size: 1, SHA256: digest},
+		{Path: "a\\\\n.txt", Size: 2, SHA256: digest},
+	}
+
+	if err := SaveManifest(path, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ReadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result) != len(entries) {
+		t.Fatalf("ReadManifest() = %v entries, want %v", len(result), len(entries))
+	}
+
+	for i, entry := range entries {
+		if *result[i] != *entry {
+			t.Errorf("ReadManifest()[%v] = %v, want %v", i, result[i], entry)
+		}
+	}
+}
+
+func TestReadManifestErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.txt")
+
+	content := "# comment\r\n\r\n" + testSHA256 + "  a.txt\r\ninvalid line\n"
+	if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadManifest(path); err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("ReadManifest() = %v, want error of line 4", err)
+	}
+}
@@ -0,0 +1,256 @@
+// File deduplication
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func usageMerge() {
+	fmt.Println("Usage: dedup merge [-v] [-l] [-i <TYPE>,...] [-e <TYPE>,...] [-sniff] [-x <GLOB>,...] [-xr <REGEX>] [-ix <GLOB>,...] [-ixr <REGEX>] [-gitignore] [-xattr <MODE>] [-f] [-paranoid] <source> <target>")
+	fmt.Println()
+	fmt.Println("Move files from <source> to the same relative paths in <target>.")
+	fmt.Println()
+	fmt.Println("Options and Arguments:")
+	fmt.Println("    -f:        Do not prompt before removing files.")
+	fmt.Println("    -l:        List files only, do not move or remove them.")
+	fmt.Println("    -paranoid: Compare file content byte by byte before removing files.")
+	fmt.Println()
+	fmt.Println("    Remark: 1) If the same content already exists in <target>,")
+	fmt.Println("               (or the source file is a hard link of a target file),")
+	fmt.Println("               then the source file is removed instead of moved.")
+	fmt.Println("            2) If a file with the same name but different content")
+	fmt.Println("               exists, then a number is appended to file name.")
+	fmt.Println("            3) Empty folders in <source> are removed.")
+	fmt.Println()
+}
+
+// Command line options of "dedup merge".
+type mergeOptions struct {
+	scanOptions
+	force    bool
+	list     bool
+	paranoid bool
+}
+
+// Register flags of "dedup merge" to a flag set.
+func (me *mergeOptions) addFlags(flags *flag.FlagSet) {
+	me.scanOptions.addFlags(flags)
+	flags.BoolVar(&me.force, "f", false, "Do not prompt before removing files.")
+	flags.BoolVar(&me.list, "l", false, "List files only, do not move or remove them.")
+	flags.BoolVar(&me.paranoid, "paranoid", false, "Compare file content byte by byte before removing files.")
+}
+
+// "dedup merge <source> <target>"
+func mainMerge(args []string) int {
+	var options mergeOptions
+
+	// Parse command line options.
+	flags := flag.NewFlagSet("merge", flag.ContinueOnError)
+	flags.Usage = usageMerge
+	options.addFlags(flags)
+	if err := parseFlags(flags, "merge", args); err != nil {
+		return 1
+	}
+
+	// If argument is missing, then exit.
+	if flags.NArg() != 2 {
+		usageMerge()
+		return 1
+	}
+
+	// Convert input paths to absolute.
+	roots, err := getAbsUniquePaths(flags.Args()[0:1])
+	if err != nil {
+		return 1
+	}
+	source := roots[0]
+
+	if roots, err = getAbsUniquePaths(flags.Args()[1:2]); err != nil {
+		return 1
+	}
+	target := roots[0]
+
+	if SameOrIsChild(source, target) || SameOrIsChild(target, source) {
+		fmt.Fprintf(os.Stderr, "%v\n", ErrOverlappedPaths)
+		return 1
+	}
+
+	// Files in target folder whose sizes are different from
+	// all source files do not need to calculate hashes.
+	scanner, updater, err := options.newScanner([]string{source, target})
+	if err != nil {
+		return 1
+	}
+
+	// A source file which is a hard link of a target file
+	// is a duplicate, so hard links must be kept.
+	scanner.SetSizeFilter(getFileSizes(source))
+	scanner.SetKeepHardLinks(true)
+
+	if err := scanner.Scan(); err != nil {
+		return 1
+	}
+
+	// Device and inode numbers of target files.
+	targetIds := getScannedFileIds(scanner, target, "")
+
+	// Result variables
+	var movedFiles int = 0
+	var movedBytes int64 = 0
+	var deletedFiles int = 0
+	var deletedBytes int64 = 0
+
+	// Files moved this time, including duplicated ones in source folder.
+	// Values are their new paths (or source paths in list mode).
+	moved := make(map[SHA256Digest]string)
+
+	// Target paths (only for list mode).
+	reserved := make(map[string]bool)
+
+	updater.Log(LOG_INFO, "<Merged Files>")
+
+	for _, file := range getSortedScannedFiles(scanner) {
+		// Check if it's a source file.
+		if !SameOrIsChild(source, file.Path) {
+			continue
+		}
+
+		// Check if it's a hard link of a target file,
+		// or the same content exists in target folder.
+		matched := "hard link"
+		if !targetIds[file.Id] {
+			matched = findMergeTarget(file, target, moved[file.SHA256], options.paranoid, scanner, updater)
+		}
+
+		if len(matched) > 0 {
+			if options.list {
+				updater.Log(LOG_INFO, "%v will be deleted (%v).", file.Path, matched)
+				deletedFiles++
+				deletedBytes += file.Size
+				continue
+			}
+
+			if !options.force {
+				// Prompt before remove file.
+				updater.Log(LOG_INFO, "%v (%v)", file.Path, matched)
+				if result := promptRemove(file); result == PROMPT_ANSWER_SKIP {
+					continue
+				} else if result == PROMPT_ANSWER_QUIT {
+					scanner.SaveCache()
+					return 1
+				} else if result == PROMPT_ANSWER_CONTINUE {
+					options.force = true
+				}
+			}
+
+			if removeFile(file, scanner, updater) {
+				deletedFiles++
+				deletedBytes += file.Size
+			}
+			continue
+		}
+
+		// Same relative path in target folder, if the name
+		// is used by a different file, then rename it.
+		relPath := GetRelativePath([]string{source}, file.Path)
+		newPath := GetUnusedPath(filepath.Join(target, filepath.FromSlash(relPath)), reserved)
+
+		if options.list {
+			reserved[GetPathAsKey(newPath)] = true
+			moved[file.SHA256] = file.Path
+		} else if err := MoveFile(file.Path, newPath); err != nil {
+			updater.IncreaseErrors()
+			updater.Log(LOG_ERROR, "Could not move %v to %v (%v).", file.Path, newPath, err)
+			continue
+		}
+
+		updater.Log(LOG_INFO, "%v -> %v", file.Path, newPath)
+		if !options.list {
+			moved[file.SHA256] = newPath
+		}
+
+		movedFiles++
+		movedBytes += file.Size
+	}
+
+	// Remove empty source folders.
+	var removedFolders int = 0
+	if !options.list {
+		removedFolders = RemoveEmptyFolders(source)
+	}
+
+	// Update local cache.
+	//
+	// Moved files are still in cache with their old paths,
+	// they will be found by device and inode next time.
+	scanner.SaveCache()
+
+	updater.Log(LOG_INFO, "")
+	logScanSummary(scanner, updater)
+
+	if options.list {
+		updater.Log(LOG_INFO, "Files to Move:    %v (%.3f MB)", movedFiles, float64(movedBytes)/(1024*1024))
+		updater.Log(LOG_INFO, "Files to Delete:  %v (%.3f MB)", deletedFiles, float64(deletedBytes)/(1024*1024))
+	} else {
+		updater.Log(LOG_INFO, "Moved Files:      %v (%.3f MB)", movedFiles, float64(movedBytes)/(1024*1024))
+		updater.Log(LOG_INFO, "Deleted Files:    %v (%.3f MB)", deletedFiles, float64(deletedBytes)/(1024*1024))
+		updater.Log(LOG_INFO, "Removed Folders:  %v", removedFolders)
+	}
+
+	if updater.Errors() > 0 {
+		updater.Log(LOG_INFO, "Errors:           %v", updater.Errors())
+	}
+
+	return 0
+}
+
+// Find a file in target folder (or moved there this time)
+// having the same content as the source file.
+//
+// Return its path, or "" if there is none. With paranoid on,
+// saved hashes are not trusted and file content is compared.
+func findMergeTarget(file *FileAttr, target, moved string,
+	paranoid bool, scanner FileScanner, updater Updater) string {
+
+	var candidates []*FileAttr
+	if len(moved) > 0 {
+		candidates = append(candidates, &FileAttr{Path: moved})
+	}
+
+	for _, item := range scanner.GetScannedFiles()[file.SHA256] {
+		// Check file size here to avoid hash collision.
+		if item.Size == file.Size && SameOrIsChild(target, item.Path) {
+			candidates = append(candidates, item)
+		}
+	}
+
+	for _, item := range candidates {
+		if !paranoid {
+			return item.Path
+		}
+
+		same, err := SameContent(file.Path, item.Path)
+		if err != nil {
+			updater.IncreaseErrors()
+			updater.Log(LOG_ERROR, "Could not compare %v with %v (%v).",
+				file.Path, item.Path, err)
+			continue
+		}
+
+		if same {
+			return item.Path
+		}
+
+		updater.Log(LOG_WARN, "%v is different from %v, saved hash is stale.",
+			file.Path, item.Path)
+		scanner.OnFileChanged(file)
+		if item.Id.IsValid() {
+			scanner.OnFileChanged(item)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,63 @@
+// File deduplication
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+)
+
+// Number of bytes needed to detect content type.
+const SNIFF_LENGTH = 512
+
+// Magic bytes which are not recognized by http.DetectContentType().
+var magicMapping = []struct {
+	offset      int
+	magic       string
+	contentType string
+}{
+	{0, "7z\xBC\xAF\x27\x1C", "application/x-7z-compressed"},
+	{0, "BZh", "application/x-bzip2"},
+	{0, "\xFD7zXZ\x00", "application/x-xz"},
+	{0, "\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1", "application/x-ole-storage"},
+	{0, "II*\x00", "image/tiff"},
+	{0, "MM\x00*", "image/tiff"},
+	{0, "fLaC", "audio/flac"},
+	{4, "ftypheic", "image/heic"},
+	{4, "ftypheix", "image/heic"},
+	{4, "ftypmif1", "image/heif"},
+	{4, "ftypqt  ", "video/quicktime"},
+	{4, "ftypM4A ", "audio/mp4"},
+	{257, "ustar", "application/x-tar"},
+}
+
+// Detect content type (MIME) by magic bytes,
+// "data" is the beginning of file content.
+func DetectContentType(data []byte) string {
+	for _, item := range magicMapping {
+		if len(data) >= item.offset+len(item.magic) &&
+			bytes.Equal(data[item.offset:item.offset+len(item.magic)], []byte(item.magic)) {
+			return item.contentType
+		}
+	}
+
+	return http.DetectContentType(data)
+}
+
+// Read the beginning of a file and detect its content type.
+func SniffContentType(path string) (string, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	data := make([]byte, SNIFF_LENGTH)
+	n, err := io.ReadFull(fp, data)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	return DetectContentType(data[0:n]), nil
+}
@@ -4,6 +4,7 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
@@ -86,3 +87,71 @@ func GetAbsPath(path string) (string, error) {
 	abs = filepath.Clean(abs)
 	return strings.TrimRight(abs, string(os.PathSeparator)), nil
 }
+
+// Get path relative to the root path containing it.
+//
+// Path separators of returned string are always "/",
+// so it could be used on any platforms. If the path
+// itself is a root path, then its base name is returned.
+func GetRelativePath(roots []string, path string) string {
+	for _, root := range roots {
+		if !SameOrIsChild(root, path) {
+			continue
+		}
+
+		if len(root) == len(path) {
+			return filepath.Base(path)
+		}
+
+		return filepath.ToSlash(path[len(root)+1:])
+	}
+
+	return filepath.ToSlash(path)
+}
+
+// Convert a glob pattern to regular expression.
+//
+// 1) "**" matches any characters, including "/".
+// 2) "*" matches any characters except "/".
+// 3) "?" matches a single character except "/".
+//
+// If the pattern does not start with "/" or "**", then it matches
+// the end of a path, e.g. "a/*.txt" matches "/x/a/b.txt".
+//
+// The pattern should be matched with slash separated paths,
+// see filepath.ToSlash(). It's case insensitive on Windows.
+func CompileGlob(pattern string) (*regexp.Regexp, error) {
+	var builder strings.Builder
+
+	if os.PathSeparator != '/' {
+		builder.WriteString("(?i)")
+	}
+
+	if strings.HasPrefix(pattern, "/") || strings.HasPrefix(pattern, "**") {
+		builder.WriteString("^")
+	} else {
+		builder.WriteString("(^|/)")
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				builder.WriteString(".*")
+				i++
+			} else {
+				builder.WriteString("[^/]*")
+			}
+
+		case '?':
+			builder.WriteString("[^/]")
+
+		default:
+			builder.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	builder.WriteString("$")
+
+	return regexp.Compile(builder.String())
+}
@@ -0,0 +1,63 @@
+// File deduplication
+package main
+
+import (
+	"testing"
+)
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		// Patterns not starting with "/" or "**" match the end of paths.
+		{".git", "/src/app/.git", true},
+		{".git", "/src/app/.github", false},
+		{".git", "/src/app.git", false},
+		{"a/*.txt", "/x/a/b.txt", true},
+		{"a/*.txt", "/x/a/b/c.txt", false},
+		{"Thumbs.db", "/photos/Thumbs.db", true},
+
+		// Patterns starting with "/" match the whole path.
+		{"/tmp", "/tmp", true},
+		{"/tmp", "/x/tmp", false},
+		{"/tmp/*", "/tmp/a", true},
+		{"/tmp/*", "/tmp/a/b", false},
+
+		// "**" matches any characters, including "/".
+		{"/tmp/**", "/tmp/a/b", true},
+		{"**/DCIM/**", "/media/card/DCIM/100/a.jpg", true},
+		{"**/DCIM/**", "/media/card/DCIM", false},
+		{"**.jpg", "/a/b/c.jpg", true},
+		{"**/cache/", "/a/cache/", true},
+
+		// "*" and "?" do not match "/".
+		{"a*c", "/abbc", true},
+		{"a*c", "/ab/c", false},
+		{"a?c", "/abc", true},
+		{"a?c", "/a/c", false},
+		{"a?c", "/abbc", false},
+
+		// Other characters are literal, including regular expression ones.
+		{"a+b(1).txt", "/a+b(1).txt", true},
+		{"a+b(1).txt", "/aab1.txt", false},
+		{"[ab].txt", "/[ab].txt", true},
+		{"[ab].txt", "/a.txt", false},
+		{"a.txt", "/abtxt", false},
+		{"a\\b", "/a\\b", true},
+		{"^a$", "/^a$", true},
+	}
+
+	for _, test := range tests {
+		pattern, err := CompileGlob(test.pattern)
+		if err != nil {
+			t.Errorf("CompileGlob(%q) failed: %v", test.pattern, err)
+			continue
+		}
+
+		if match := pattern.MatchString(test.path); match != test.match {
+			t.Errorf("%q matching %q = %v, want %v", test.pattern, test.path, match, test.match)
+		}
+	}
+}
@@ -2,7 +2,14 @@
 package main
 
 import (
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -25,39 +32,390 @@ const (
 
 	// -1 means short path and 1 means long path.
 	POLICY_CATEGORY_PATH
-)
 
-// Number of policy categories.
-const POLICY_CATEGORY_COUNT = 3
+	// Files under preferred folders, 1 means files not under
+	// preferred folders (or under later-listed ones).
+	POLICY_CATEGORY_PREFER
+
+	// Order of command line paths, 1 means later-listed paths.
+	POLICY_CATEGORY_ROOT
+
+	// File names with copy markers, e.g. "Copy of X", "X (1)".
+	// 1 means names with copy markers.
+	POLICY_CATEGORY_COPY_NAME
+
+	// Keep (or delete) rules, e.g. "keep:glob=**/Originals/**".
+	// -1 means files not matching the rule (keep rule),
+	// 1 means files matching the rule (delete rule).
+	//
+	// A policy might have multiple rules, they are evaluated
+	// in order before other categories.
+	POLICY_CATEGORY_RULE
+
+	// -1 means shallow path (fewer folders) and 1 means deep path.
+	POLICY_CATEGORY_DEPTH
+
+	// -1 means old and 1 means new last change time (ctime).
+	POLICY_CATEGORY_CHANGE_TIME
+
+	// -1 means old and 1 means new creation (birth) time.
+	POLICY_CATEGORY_BIRTH_TIME
+
+	// Files owned by preferred users, 1 means files owned by others.
+	POLICY_CATEGORY_OWNER
+
+	// Files owned by preferred groups, 1 means files owned by others.
+	POLICY_CATEGORY_GROUP
+
+	// -1 means fewer hard links and 1 means more hard links.
+	POLICY_CATEGORY_LINKS
+
+	// -1 means read-only and 1 means writable files.
+	POLICY_CATEGORY_WRITABLE
+
+	// Clauses of policy expression, e.g. "older(mtime)".
+	// -1 means files with smaller value and 1 means larger value,
+	// see exprClause.getValue().
+	//
+	// A policy expression might have multiple clauses,
+	// they are evaluated in order.
+	POLICY_CATEGORY_EXPR
+)
 
 // Policy item mapping table.
 var policyItemMapping = map[string]*policyItem{
-	"old":       &policyItem{category: POLICY_CATEGORY_MOD_TIME, value: -1},
-	"new":       &policyItem{category: POLICY_CATEGORY_MOD_TIME, value: 1},
-	"shortname": &policyItem{category: POLICY_CATEGORY_NAME, value: -1},
-	"longname":  &policyItem{category: POLICY_CATEGORY_NAME, value: 1},
-	"shortpath": &policyItem{category: POLICY_CATEGORY_PATH, value: -1},
-	"longpath":  &policyItem{category: POLICY_CATEGORY_PATH, value: 1},
+	"old":        &policyItem{name: "old", category: POLICY_CATEGORY_MOD_TIME, value: -1},
+	"new":        &policyItem{name: "new", category: POLICY_CATEGORY_MOD_TIME, value: 1},
+	"shortname":  &policyItem{name: "shortname", category: POLICY_CATEGORY_NAME, value: -1},
+	"longname":   &policyItem{name: "longname", category: POLICY_CATEGORY_NAME, value: 1},
+	"shortpath":  &policyItem{name: "shortpath", category: POLICY_CATEGORY_PATH, value: -1},
+	"longpath":   &policyItem{name: "longpath", category: POLICY_CATEGORY_PATH, value: 1},
+	"root-order": &policyItem{name: "root-order", category: POLICY_CATEGORY_ROOT, value: 1},
+	"copyname":   mustNewCopyNamePolicyItem(DEFAULT_COPY_NAME_PATTERNS),
+	"shallow":    &policyItem{name: "shallow", category: POLICY_CATEGORY_DEPTH, value: -1},
+	"deep":       &policyItem{name: "deep", category: POLICY_CATEGORY_DEPTH, value: 1},
+	"oldchange":  &policyItem{name: "oldchange", category: POLICY_CATEGORY_CHANGE_TIME, value: -1},
+	"newchange":  &policyItem{name: "newchange", category: POLICY_CATEGORY_CHANGE_TIME, value: 1},
+	"oldbirth":   &policyItem{name: "oldbirth", category: POLICY_CATEGORY_BIRTH_TIME, value: -1},
+	"newbirth":   &policyItem{name: "newbirth", category: POLICY_CATEGORY_BIRTH_TIME, value: 1},
+	"fewlinks":   &policyItem{name: "fewlinks", category: POLICY_CATEGORY_LINKS, value: -1},
+	"manylinks":  &policyItem{name: "manylinks", category: POLICY_CATEGORY_LINKS, value: 1},
+	"readonly":   &policyItem{name: "readonly", category: POLICY_CATEGORY_WRITABLE, value: -1},
+	"writable":   &policyItem{name: "writable", category: POLICY_CATEGORY_WRITABLE, value: 1},
 }
 
+// Policy items with arguments ("name=value").
+var policyItemArgMapping = map[string]func(value string) (*policyItem, error){
+	"prefer":   newPreferPolicyItem,
+	"copyname": newCopyNamePolicyItem,
+	"owner":    newOwnerPolicyItem,
+	"group":    newGroupPolicyItem,
+
+	"keep:glob":    func(value string) (*policyItem, error) { return newRulePolicyItem(-1, "glob", value) },
+	"keep:regex":   func(value string) (*policyItem, error) { return newRulePolicyItem(-1, "regex", value) },
+	"keep:ext":     func(value string) (*policyItem, error) { return newRulePolicyItem(-1, "ext", value) },
+	"delete:glob":  func(value string) (*policyItem, error) { return newRulePolicyItem(1, "glob", value) },
+	"delete:regex": func(value string) (*policyItem, error) { return newRulePolicyItem(1, "regex", value) },
+	"delete:ext":   func(value string) (*policyItem, error) { return newRulePolicyItem(1, "ext", value) },
+}
+
+// Default copy marker patterns of policy "copyname".
+//
+// "*" is the original name and "#" is a counter (1 or 2 digits),
+// so "Report (2020)" is not taken as a copy of "Report".
+const DEFAULT_COPY_NAME_PATTERNS = "Copy of *,Copy (#) of *,* - Copy,* - Copy (#)," +
+	"* (#),*_copy,*_copy#,* copy,* copy #,*.bak,*~"
+
 // Default policy.
 var defaultPolicyItems = []*policyItem{
-	&policyItem{category: POLICY_CATEGORY_NAME, value: 1},
-	&policyItem{category: POLICY_CATEGORY_PATH, value: 1},
-	&policyItem{category: POLICY_CATEGORY_MOD_TIME, value: 1},
+	&policyItem{name: "longname", category: POLICY_CATEGORY_NAME, value: 1},
+	&policyItem{name: "longpath", category: POLICY_CATEGORY_PATH, value: 1},
+	&policyItem{name: "new", category: POLICY_CATEGORY_MOD_TIME, value: 1},
 }
 
 // Policy interface.
 type Policy interface {
-	// Once returned, files[0] needs to keep
-	// and the rest of files could be removed.
+	// Once returned, files are ranked from best to worst,
+	// files[0] needs to keep and the rest of files could be removed.
 	Sort(files []*FileAttr)
+
+	// Number of files to keep decided by policy, files should be sorted.
+	// 0 means it's not decided by policy, see "-keep <N>".
+	GetKeepCount(files []*FileAttr) int
+
+	// Explain why each file is ranked before the next one,
+	// files should be sorted. One line is returned for each
+	// of files except the first one.
+	Explain(files []*FileAttr) []string
 }
 
 // Policy item.
 type policyItem struct {
+	// Policy item spec, e.g. "new", "prefer=/aa,/bb".
+	name string
+
 	category int
 	value    int
+
+	// Preferred folders (POLICY_CATEGORY_PREFER).
+	folders []string
+
+	// Preferred user (or group) IDs (POLICY_CATEGORY_OWNER, POLICY_CATEGORY_GROUP).
+	ids []uint32
+
+	// Copy marker patterns (POLICY_CATEGORY_COPY_NAME), or
+	// patterns matching slash separated path (POLICY_CATEGORY_RULE).
+	patterns []*regexp.Regexp
+
+	// Clause of policy expression (POLICY_CATEGORY_EXPR).
+	clause *exprClause
+}
+
+// Keep (or delete) rules.
+//
+// 1) "glob": Glob patterns matching full path, e.g. "**/Originals/**".
+// 2) "regex": Regular expression searching full path, e.g. "/tmp/|/Downloads/".
+// 3) "ext": File extensions, e.g. ".raw,.cr2".
+//
+// Full paths are always separated by "/", even on Windows.
+func newRulePolicyItem(value int, kind string, spec string) (*policyItem, error) {
+	item := &policyItem{category: POLICY_CATEGORY_RULE, value: value}
+
+	if len(spec) == 0 {
+		return nil, ErrInvalidPolicy
+	}
+
+	switch kind {
+	case "glob":
+		for _, glob := range strings.Split(spec, ",") {
+			pattern, err := CompileGlob(glob)
+			if err != nil || len(glob) == 0 {
+				return nil, ErrInvalidPolicy
+			}
+
+			item.patterns = append(item.patterns, pattern)
+		}
+
+	case "regex":
+		pattern, err := regexp.Compile(spec)
+		if err != nil {
+			return nil, ErrInvalidPolicy
+		}
+
+		item.patterns = append(item.patterns, pattern)
+
+	case "ext":
+		exts := strings.Split(spec, ",")
+		for i, ext := range exts {
+			if len(ext) == 0 {
+				return nil, ErrInvalidPolicy
+			}
+
+			exts[i] = regexp.QuoteMeta(ext)
+		}
+
+		item.patterns = append(item.patterns,
+			regexp.MustCompile("(?i)("+strings.Join(exts, "|")+")$"))
+	}
+
+	return item, nil
+}
+
+// Check if full path of the file matches any rule patterns.
+func (me *policyItem) matchRule(file *FileAttr) bool {
+	path := filepath.ToSlash(file.Path)
+
+	for _, pattern := range me.patterns {
+		if pattern.MatchString(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// "prefer=/aa,/bb": Keep files under preferred folders,
+// earlier-listed folders win.
+func newPreferPolicyItem(value string) (*policyItem, error) {
+	item := &policyItem{category: POLICY_CATEGORY_PREFER, value: 1}
+
+	for _, folder := range strings.Split(value, ",") {
+		abs, err := GetAbsPath(folder)
+		if err != nil || len(folder) == 0 {
+			return nil, ErrInvalidPolicy
+		}
+
+		item.folders = append(item.folders, abs)
+	}
+
+	return item, nil
+}
+
+// Get index of the first preferred folder containing the file.
+//
+// If the file is not under any preferred folders,
+// then number of folders is returned.
+func (me *policyItem) getFolderIndex(file *FileAttr) int {
+	for i, folder := range me.folders {
+		// Root path "/" is converted to "" by GetAbsPath().
+		if len(folder) == 0 || SameOrIsChild(folder, file.Path) {
+			return i
+		}
+	}
+
+	return len(me.folders)
+}
+
+// "owner=archive,root": Keep files owned by preferred users,
+// earlier-listed users win. Both user names and IDs are accepted.
+func newOwnerPolicyItem(value string) (*policyItem, error) {
+	item := &policyItem{category: POLICY_CATEGORY_OWNER, value: 1}
+
+	for _, name := range strings.Split(value, ",") {
+		if len(name) == 0 {
+			return nil, ErrInvalidPolicy
+		}
+
+		if current, err := user.Lookup(name); err == nil {
+			name = current.Uid
+		}
+
+		if id, err := strconv.ParseUint(name, 10, 32); err != nil {
+			return nil, ErrInvalidPolicy
+		} else {
+			item.ids = append(item.ids, uint32(id))
+		}
+	}
+
+	return item, nil
+}
+
+// "group=archive,root": Keep files owned by preferred groups,
+// earlier-listed groups win. Both group names and IDs are accepted.
+func newGroupPolicyItem(value string) (*policyItem, error) {
+	item := &policyItem{category: POLICY_CATEGORY_GROUP, value: 1}
+
+	for _, name := range strings.Split(value, ",") {
+		if len(name) == 0 {
+			return nil, ErrInvalidPolicy
+		}
+
+		if group, err := user.LookupGroup(name); err == nil {
+			name = group.Gid
+		}
+
+		if id, err := strconv.ParseUint(name, 10, 32); err != nil {
+			return nil, ErrInvalidPolicy
+		} else {
+			item.ids = append(item.ids, uint32(id))
+		}
+	}
+
+	return item, nil
+}
+
+// Get index of the first preferred user (or group) ID.
+//
+// If it's not preferred, then number of IDs is returned.
+func (me *policyItem) getIdIndex(id uint32) int {
+	for i, value := range me.ids {
+		if value == id {
+			return i
+		}
+	}
+
+	return len(me.ids)
+}
+
+// "copyname=Copy of *,* (#)": Remove files whose names have copy markers.
+//
+// In patterns, "*" is the original name and "#" is a counter of
+// 1 or 2 digits, larger numbers are usually part of the name.
+// Patterns are case insensitive.
+func newCopyNamePolicyItem(value string) (*policyItem, error) {
+	item := &policyItem{category: POLICY_CATEGORY_COPY_NAME, value: 1}
+
+	for _, pattern := range strings.Split(value, ",") {
+		if !strings.Contains(pattern, "*") {
+			return nil, ErrInvalidPolicy
+		}
+
+		fields := strings.Split(pattern, "*")
+		for i, field := range fields {
+			fields[i] = strings.ReplaceAll(regexp.QuoteMeta(field), "#", "[0-9]{1,2}")
+		}
+
+		str := strings.Join(fields, "(.+)")
+
+		item.patterns = append(item.patterns, regexp.MustCompile("(?i)^"+str+"$"))
+	}
+
+	return item, nil
+}
+
+func mustNewCopyNamePolicyItem(value string) *policyItem {
+	item, err := newCopyNamePolicyItem(value)
+	if err != nil {
+		panic(err)
+	}
+
+	item.name = "copyname"
+	return item
+}
+
+// Check if file name has a copy marker.
+//
+// Both full name and the name without extension are checked,
+// e.g. "X (1).jpg" and "X.jpg.bak".
+func (me *policyItem) hasCopyMarker(file *FileAttr) bool {
+	base := strings.TrimSuffix(file.Name, filepath.Ext(file.Name))
+
+	for _, pattern := range me.patterns {
+		if pattern.MatchString(file.Name) || (len(base) > 0 && pattern.MatchString(base)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Convert a bool value to a number for comparison.
+func boolToInt64(value bool) int64 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
+
+// Compare values of the two files.
+//
+// If "value" of policy item is less than 0, then the file
+// with smaller value is removed, otherwise the larger one is removed.
+func deleteByValue(first, second int64, value int) int {
+	if first == second {
+		return DELETE_WHICH_EITHER
+	}
+
+	if (first < second) == (value < 0) {
+		return DELETE_WHICH_FIRST
+	} else {
+		return DELETE_WHICH_SECOND
+	}
+}
+
+// Compare times of the two files, 0 means that time is unknown.
+//
+// Files with unknown time are always removed first (ranked after
+// files with known time), so files are in a strict weak order.
+func deleteByTime(first, second int64, value int) int {
+	if first == 0 && second != 0 {
+		return DELETE_WHICH_FIRST
+	} else if first != 0 && second == 0 {
+		return DELETE_WHICH_SECOND
+	}
+
+	return deleteByValue(first, second, value)
 }
 
 // Policy implementation.
@@ -65,82 +423,207 @@ type policyImpl struct {
 	items []*policyItem
 }
 
+// Files are ranked by policy items in order,
+// a file which should be kept comes first.
 func (me *policyImpl) Sort(files []*FileAttr) {
-	index := 0
+	sort.SliceStable(files, func(i, j int) bool {
+		return me.deleteWhich(files[i], files[j]) == DELETE_WHICH_SECOND
+	})
+}
 
-	for i := 1; i < len(files); i++ {
-		if me.deleteWhich(files[index], files[i]) == DELETE_WHICH_FIRST {
-			index = i
+func (me *policyImpl) GetKeepCount(files []*FileAttr) int {
+	return 0
+}
+
+func (me *policyImpl) deleteWhich(first, second *FileAttr) int {
+	result, _ := me.decide(first, second)
+	return result
+}
+
+// Check which file should be removed, and return the policy item
+// which decided it. If no policy item decided, nil is returned.
+func (me *policyImpl) decide(first, second *FileAttr) (int, *policyItem) {
+	for _, item := range me.items {
+		if result := item.deleteWhich(first, second); result != DELETE_WHICH_EITHER {
+			return result, item
 		}
 	}
 
-	if index != 0 {
-		tmp := files[0]
-		files[0] = files[index]
-		files[index] = tmp
+	// No rule for the two files, then keep the lexically smaller path,
+	// so the result does not depend on scanning order.
+	if first.Path < second.Path {
+		return DELETE_WHICH_SECOND, nil
+	} else if first.Path > second.Path {
+		return DELETE_WHICH_FIRST, nil
 	}
+
+	return DELETE_WHICH_EITHER, nil
 }
 
-func (me *policyImpl) deleteWhich(first, second *FileAttr) int {
-	for _, item := range me.items {
-		switch item.category {
-		case POLICY_CATEGORY_MOD_TIME:
-			if first.ModTime != second.ModTime {
-				if first.ModTime < second.ModTime {
-					if item.value < 0 {
-						return DELETE_WHICH_FIRST
-					} else {
-						return DELETE_WHICH_SECOND
-					}
-				} else {
-					if item.value < 0 {
-						return DELETE_WHICH_SECOND
-					} else {
-						return DELETE_WHICH_FIRST
-					}
-				}
-			}
+func (me *policyImpl) Explain(files []*FileAttr) []string {
+	lines := make([]string, 0, len(files))
 
-		case POLICY_CATEGORY_NAME:
-			if len(first.Name) != len(second.Name) {
-				if len(first.Name) < len(second.Name) {
-					if item.value < 0 {
-						return DELETE_WHICH_FIRST
-					} else {
-						return DELETE_WHICH_SECOND
-					}
-				} else {
-					if item.value < 0 {
-						return DELETE_WHICH_SECOND
-					} else {
-						return DELETE_WHICH_FIRST
-					}
-				}
-			}
+	for i := 1; i < len(files); i++ {
+		result, item := me.decide(files[i-1], files[i])
 
-		case POLICY_CATEGORY_PATH:
-			if len(first.Path) != len(second.Path) {
-				if len(first.Path) < len(second.Path) {
-					if item.value < 0 {
-						return DELETE_WHICH_FIRST
-					} else {
-						return DELETE_WHICH_SECOND
-					}
-				} else {
-					if item.value < 0 {
-						return DELETE_WHICH_SECOND
-					} else {
-						return DELETE_WHICH_FIRST
-					}
-				}
-			}
+		if result == DELETE_WHICH_FIRST {
+			// Files were reordered, see SelectKeepers().
+			lines = append(lines, fmt.Sprintf("%v) over %v): reordered to keep distinct copies", i, i+1))
+		} else if item == nil {
+			lines = append(lines, fmt.Sprintf("%v) over %v): no policy item decided, smaller path ranked first", i, i+1))
+		} else {
+			lines = append(lines, fmt.Sprintf("%v) over %v): decided by \"%v\" (%v vs %v)",
+				i, i+1, item.name, item.describe(files[i-1]), item.describe(files[i])))
 		}
 	}
 
-	// No rule for the two files, then we could delete either.
+	return lines
+}
+
+// Check which file should be removed according to this policy item only.
+func (me *policyItem) deleteWhich(first, second *FileAttr) int {
+	switch me.category {
+	case POLICY_CATEGORY_MOD_TIME:
+		return deleteByValue(first.ModTime, second.ModTime, me.value)
+
+	case POLICY_CATEGORY_NAME:
+		return deleteByValue(int64(len(first.Name)), int64(len(second.Name)), me.value)
+
+	case POLICY_CATEGORY_PATH:
+		return deleteByValue(int64(len(first.Path)), int64(len(second.Path)), me.value)
+
+	case POLICY_CATEGORY_PREFER:
+		return deleteByValue(int64(me.getFolderIndex(first)),
+			int64(me.getFolderIndex(second)), me.value)
+
+	case POLICY_CATEGORY_ROOT:
+		return deleteByValue(int64(first.Root), int64(second.Root), me.value)
+
+	case POLICY_CATEGORY_COPY_NAME:
+		return deleteByValue(boolToInt64(me.hasCopyMarker(first)),
+			boolToInt64(me.hasCopyMarker(second)), me.value)
+
+	case POLICY_CATEGORY_RULE:
+		return deleteByValue(boolToInt64(me.matchRule(first)),
+			boolToInt64(me.matchRule(second)), me.value)
+
+	case POLICY_CATEGORY_DEPTH:
+		return deleteByValue(int64(first.GetDepth()), int64(second.GetDepth()), me.value)
+
+	case POLICY_CATEGORY_CHANGE_TIME:
+		return deleteByValue(first.ChangeTime, second.ChangeTime, me.value)
+
+	case POLICY_CATEGORY_BIRTH_TIME:
+		// Birth time might be unknown.
+		return deleteByTime(first.GetBirthTime(), second.GetBirthTime(), me.value)
+
+	case POLICY_CATEGORY_OWNER:
+		return deleteByValue(int64(me.getIdIndex(first.Uid)),
+			int64(me.getIdIndex(second.Uid)), me.value)
+
+	case POLICY_CATEGORY_GROUP:
+		return deleteByValue(int64(me.getIdIndex(first.Gid)),
+			int64(me.getIdIndex(second.Gid)), me.value)
+
+	case POLICY_CATEGORY_LINKS:
+		return deleteByValue(int64(first.Links), int64(second.Links), me.value)
+
+	case POLICY_CATEGORY_WRITABLE:
+		return deleteByValue(boolToInt64(first.IsWritable()),
+			boolToInt64(second.IsWritable()), me.value)
+
+	case POLICY_CATEGORY_EXPR:
+		// Time might be unknown, e.g. birth time.
+		if me.clause.field != nil && me.clause.field.kind == EXPR_FIELD_TIME {
+			return deleteByTime(me.clause.getValue(first), me.clause.getValue(second), me.value)
+		}
+
+		return deleteByValue(me.clause.getValue(first), me.clause.getValue(second), me.value)
+	}
+
 	return DELETE_WHICH_EITHER
 }
 
+// Describe the value of a file compared by this policy item.
+func (me *policyItem) describe(file *FileAttr) string {
+	switch me.category {
+	case POLICY_CATEGORY_MOD_TIME:
+		return describeTime(file.ModTime)
+
+	case POLICY_CATEGORY_NAME:
+		return fmt.Sprintf("name length %v", len(file.Name))
+
+	case POLICY_CATEGORY_PATH:
+		return fmt.Sprintf("path length %v", len(file.Path))
+
+	case POLICY_CATEGORY_PREFER:
+		if index := me.getFolderIndex(file); index < len(me.folders) {
+			return fmt.Sprintf("under %v", me.folders[index])
+		}
+
+		return "not under preferred folders"
+
+	case POLICY_CATEGORY_ROOT:
+		return fmt.Sprintf("path argument %v", file.Root+1)
+
+	case POLICY_CATEGORY_COPY_NAME:
+		if me.hasCopyMarker(file) {
+			return "copy marker"
+		}
+
+		return "no copy marker"
+
+	case POLICY_CATEGORY_RULE:
+		if me.matchRule(file) {
+			return "matched"
+		}
+
+		return "not matched"
+
+	case POLICY_CATEGORY_DEPTH:
+		return fmt.Sprintf("depth %v", file.GetDepth())
+
+	case POLICY_CATEGORY_CHANGE_TIME:
+		return describeTime(file.ChangeTime)
+
+	case POLICY_CATEGORY_BIRTH_TIME:
+		return describeTime(file.GetBirthTime())
+
+	case POLICY_CATEGORY_OWNER:
+		return fmt.Sprintf("uid %v", file.Uid)
+
+	case POLICY_CATEGORY_GROUP:
+		return fmt.Sprintf("gid %v", file.Gid)
+
+	case POLICY_CATEGORY_LINKS:
+		return fmt.Sprintf("%v links", file.Links)
+
+	case POLICY_CATEGORY_WRITABLE:
+		if file.IsWritable() {
+			return "writable"
+		}
+
+		return "read-only"
+
+	case POLICY_CATEGORY_EXPR:
+		return me.clause.describe(file)
+	}
+
+	return ""
+}
+
+// Describe a time in nanoseconds, 0 means that it's unknown.
+//
+// Sub-second digits are kept, because files are
+// often compared by sub-second differences.
+func describeTime(value int64) string {
+	if value == 0 {
+		return "unknown"
+	}
+
+	return time.Unix(0, value).Format(time.RFC3339Nano)
+}
+
 // Check if a policy item exists in an array.
 func policyItemExist(items []*policyItem, category int) bool {
 	for _, item := range items {
@@ -152,44 +635,101 @@ func policyItemExist(items []*policyItem, category int) bool {
 	return false
 }
 
+// Split policy spec into items.
+//
+// Values of "name=value" items might contain ",", e.g. "prefer=/aa,/bb",
+// so a token that is neither a policy name nor "name=value"
+// belongs to the previous item.
+func splitPolicySpec(spec string) []string {
+	items := make([]string, 0, 8)
+
+	for _, token := range strings.Split(spec, ",") {
+		_, found := policyItemMapping[strings.ToLower(token)]
+
+		if !found && len(items) > 0 &&
+			!strings.Contains(token, "=") && strings.Contains(items[len(items)-1], "=") {
+			items[len(items)-1] += "," + token
+		} else {
+			items = append(items, token)
+		}
+	}
+
+	return items
+}
+
+// Create a policy item from its spec, e.g. "new", "prefer=/aa,/bb".
+func newPolicyItem(spec string) (*policyItem, error) {
+	if item, ok := policyItemMapping[strings.ToLower(spec)]; ok {
+		return item, nil
+	}
+
+	// Policy items with arguments.
+	if index := strings.IndexByte(spec, '='); index > 0 {
+		if create, ok := policyItemArgMapping[strings.ToLower(spec[0:index])]; ok {
+			item, err := create(spec[index+1:])
+			if err != nil {
+				return nil, err
+			}
+
+			item.name = spec
+			return item, nil
+		}
+	}
+
+	return nil, ErrInvalidPolicy
+}
+
 // Create a new policy object.
 func NewPolicy(spec string) (Policy, error) {
+	// External policy program.
+	if strings.HasPrefix(spec, EXEC_POLICY_PREFIX) {
+		return newExecPolicy(spec)
+	}
+
+	items := make([]*policyItem, 0, len(defaultPolicyItems)+4)
 
-	// Number of items is always fixed.
-	items := make([]*policyItem, POLICY_CATEGORY_COUNT)
-	var count int = 0
+	// Keep (or delete) rules are evaluated before other items.
+	rules := make([]*policyItem, 0, 4)
 
 	// Parse user spec.
-	if len(spec) > 0 {
-		for _, name := range strings.Split(strings.ToLower(spec), ",") {
-			if newItem, ok := policyItemMapping[name]; ok {
-				// Check if the new item is duplicated.
-				if count > 0 && policyItemExist(items[0:count], newItem.category) {
-					return nil, ErrInvalidPolicy
-				}
-
-				// Add the new item to the array.
-				items[count] = newItem
-				count++
-			} else {
+	if IsPolicyExpr(spec) {
+		// Clauses of policy expression are evaluated in order.
+		clauses, err := compilePolicyExpr(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, clauses...)
+	} else if len(spec) > 0 {
+		for _, name := range splitPolicySpec(spec) {
+			newItem, err := newPolicyItem(name)
+			if err != nil {
+				return nil, err
+			}
+
+			// A policy might have multiple rules.
+			if newItem.category == POLICY_CATEGORY_RULE {
+				rules = append(rules, newItem)
+				continue
+			}
+
+			// Check if the new item is duplicated.
+			if policyItemExist(items, newItem.category) {
 				return nil, ErrInvalidPolicy
 			}
+
+			// Add the new item to the array.
+			items = append(items, newItem)
 		}
 	}
 
+	items = append(rules, items...)
+
 	// If any item is missing in user spec,
 	// then add it to the end.
-	if count < POLICY_CATEGORY_COUNT {
-		for _, value := range defaultPolicyItems {
-			if !policyItemExist(items[0:count], value.category) {
-				// Add the new item to the array.
-				items[count] = value
-				count++
-
-				if count == POLICY_CATEGORY_COUNT {
-					break
-				}
-			}
+	for _, value := range defaultPolicyItems {
+		if !policyItemExist(items, value.category) {
+			items = append(items, value)
 		}
 	}
 
@@ -0,0 +1,41 @@
+// File deduplication
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHasCopyMarker(t *testing.T) {
+	tests := []struct {
+		patterns string
+		name     string
+		match    bool
+	}{
+		{DEFAULT_COPY_NAME_PATTERNS, "IMG_1234 (1).jpg", true},
+		{DEFAULT_COPY_NAME_PATTERNS, "IMG_1234 (12).jpg", true},
+		{DEFAULT_COPY_NAME_PATTERNS, "Report (2020).pdf", false},
+		{DEFAULT_COPY_NAME_PATTERNS, "Report (123).pdf", false},
+		{DEFAULT_COPY_NAME_PATTERNS, "Copy of Report.pdf", true},
+		{DEFAULT_COPY_NAME_PATTERNS, "copy (2) of report.pdf", true},
+		{DEFAULT_COPY_NAME_PATTERNS, "Report - Copy (3).pdf", true},
+		{DEFAULT_COPY_NAME_PATTERNS, "Report_copy2.pdf", true},
+		{DEFAULT_COPY_NAME_PATTERNS, "Report.pdf.bak", true},
+		{DEFAULT_COPY_NAME_PATTERNS, "Report.pdf~", true},
+		{DEFAULT_COPY_NAME_PATTERNS, "Report.pdf", false},
+		{"v#_*", "v1_report.pdf", true},
+		{"v#_*", "v100_report.pdf", false},
+	}
+
+	for _, test := range tests {
+		item, err := newCopyNamePolicyItem(test.patterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file := newTestFile("/a/"+test.name, 1, time.Now())
+		if match := item.hasCopyMarker(file); match != test.match {
+			t.Errorf("%q has copy marker = %v, want %v", test.name, match, test.match)
+		}
+	}
+}
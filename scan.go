@@ -22,13 +22,45 @@ func (me *SHA256Digest) String() string {
 	return hex.EncodeToString((*me)[:])
 }
 
+// Device and inode number of a file.
+//
+// Zero value means that they are not available on this platform.
+type FileId struct {
+	Device uint64 // Device ID.
+	Inode  uint64 // Inode number.
+}
+
+// Check if device and inode number are available.
+func (me FileId) IsValid() bool {
+	return me.Inode != 0
+}
+
 // File attributes.
 type FileAttr struct {
-	Path    string       // Full path.
-	Name    string       // Name.
-	ModTime int64        // The number of nanoseconds elapsed since January 1, 1970 UTC
-	Size    int64        // File size, in bytes.
-	SHA256  SHA256Digest // SHA256 checksum.
+	Path       string       // Full path.
+	Name       string       // Name.
+	ModTime    int64        // The number of nanoseconds elapsed since January 1, 1970 UTC
+	Size       int64        // File size, in bytes.
+	SHA256     SHA256Digest // SHA256 checksum.
+	ChangeTime int64        // Last status change time (ctime), in nanoseconds.
+	Id         FileId       // Device and inode number.
+	MimeType   string       // Content type detected by magic bytes, "" if unknown.
+	Corrupted  bool         // Content does not match SHA256 any more, see "dedup verify".
+
+	// The following fields are not saved in cache file,
+	// they are set while scanning files.
+	Root  int         // Index of the command line path (root) containing this file.
+	Mode  os.FileMode // File mode and permission bits.
+	Uid   uint32      // User ID of owner.
+	Gid   uint32      // Group ID of owner.
+	Links uint64      // Number of hard links.
+
+	// Creation (birth) time, in nanoseconds.
+	//
+	// It's read on demand because it needs an extra system call,
+	// see GetBirthTime().
+	birthTime     int64
+	birthTimeRead bool
 
 	// Detailed information.
 	//
@@ -41,6 +73,55 @@ type FileAttr struct {
 	Details os.FileInfo
 }
 
+// Create a new FileAttr object, hash is not set.
+func NewFileAttr(path string, info os.FileInfo) *FileAttr {
+	file := &FileAttr{
+		Path:    path,
+		Name:    info.Name(),
+		ModTime: info.ModTime().UnixNano(),
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		Links:   1,
+		Details: info,
+	}
+
+	if id, ctime, ok := GetFileId(info); ok {
+		file.Id = id
+		file.ChangeTime = ctime
+	}
+
+	if uid, gid, links, ok := GetFileOwner(info); ok {
+		file.Uid = uid
+		file.Gid = gid
+		file.Links = links
+	}
+
+	return file
+}
+
+// Get creation (birth) time, in nanoseconds.
+//
+// If it's not supported by the platform or file system, then 0 is returned.
+func (me *FileAttr) GetBirthTime() int64 {
+	if !me.birthTimeRead && me.Details != nil {
+		me.birthTime, _ = GetBirthTime(me.Path, me.Details)
+		me.birthTimeRead = true
+	}
+
+	return me.birthTime
+}
+
+// Get number of folders in the path,
+// e.g. depth of "/aa/bb/cc.txt" is 2.
+func (me *FileAttr) GetDepth() int {
+	return strings.Count(me.Path, string(os.PathSeparator)) - 1
+}
+
+// Check if the file is writable by its owner.
+func (me *FileAttr) IsWritable() bool {
+	return me.Mode.Perm()&0200 != 0
+}
+
 func (me *FileAttr) String() string {
 	return fmt.Sprintf("%v(%v,%v bytes,%v)",
 		me.Path, me.Name, me.Size, &me.SHA256)
@@ -68,8 +149,11 @@ func (me *FileAttr) ReadCache(reader *bufio.Reader) error {
 	}
 
 	// Start to parse the line.
+	//
+	// Old cache files do not have the last 5 fields
+	// (change time, device, inode, content type and corrupted flag).
 	fields := strings.Split(str, "|")
-	if len(fields) != 4 {
+	if len(fields) != 4 && len(fields) != 7 && len(fields) != 8 && len(fields) != 9 {
 		return ErrInvalidCacheFile
 	}
 
@@ -114,6 +198,43 @@ func (me *FileAttr) ReadCache(reader *bufio.Reader) error {
 		copy(me.SHA256[:], digest)
 	}
 
+	if len(fields) >= 7 {
+		// Change time.
+		if number, err := strconv.ParseInt(fields[4], 10, 64); err != nil {
+			return ErrInvalidCacheFile
+		} else {
+			me.ChangeTime = number
+		}
+
+		// Device.
+		if number, err := strconv.ParseUint(fields[5], 10, 64); err != nil {
+			return ErrInvalidCacheFile
+		} else {
+			me.Id.Device = number
+		}
+
+		// Inode.
+		if number, err := strconv.ParseUint(fields[6], 10, 64); err != nil {
+			return ErrInvalidCacheFile
+		} else {
+			me.Id.Inode = number
+		}
+	}
+
+	// Content type.
+	if len(fields) >= 8 {
+		me.MimeType = fields[7]
+	}
+
+	// Corrupted flag.
+	if len(fields) == 9 {
+		if value, err := strconv.ParseBool(fields[8]); err != nil {
+			return ErrInvalidCacheFile
+		} else {
+			me.Corrupted = value
+		}
+	}
+
 	// Field "Details" now is null, will be set to
 	// valid value when scanning files.
 	me.Details = nil
@@ -123,16 +244,26 @@ func (me *FileAttr) ReadCache(reader *bufio.Reader) error {
 
 // Write a FileAttr object to cache file.
 func (me *FileAttr) SaveCache(writer *bufio.Writer) error {
-	str := fmt.Sprintf("%v|%v|%v|%v\n",
-		me.Path, me.ModTime, me.Size, &me.SHA256)
+	str := fmt.Sprintf("%v|%v|%v|%v|%v|%v|%v|%v|%v\n",
+		me.Path, me.ModTime, me.Size, &me.SHA256,
+		me.ChangeTime, me.Id.Device, me.Id.Inode, me.MimeType, me.Corrupted)
 
 	_, err := writer.WriteString(str)
 	return err
 }
 
+// File whose content does not match its saved hash.
+type CorruptedFile struct {
+	File     *FileAttr    // Current attributes and hash.
+	Expected SHA256Digest // Saved hash.
+}
+
 // File scanner interface.
 type FileScanner interface {
 
+	// Get source paths to scan.
+	GetPaths() []string
+
 	// Get total files.
 	//
 	// This function should be called after scanning files.
@@ -156,6 +287,40 @@ type FileScanner interface {
 	// This event is used to update cache file.
 	OnFileRemoved(removed *FileAttr)
 
+	// File changed event, its saved hash is not valid any more.
+	//
+	// This event is used to update cache file and extended attribute.
+	OnFileChanged(changed *FileAttr)
+
+	// Scan files of specified sizes only.
+	//
+	// Files of other sizes are skipped before calculating hashes,
+	// it must be called before Scan().
+	SetSizeFilter(sizes map[int64]bool)
+
+	// Calculate hashes again even if saved hashes are valid,
+	// and compare them with saved ones.
+	//
+	// It must be called before Scan().
+	SetVerify(verify bool)
+
+	// Keep hard links of the same file as different files.
+	//
+	// By default, only one path of a file is kept, because removing
+	// a hard link does not free any space. It must be called before Scan().
+	SetKeepHardLinks(keep bool)
+
+	// Names of ignore files in gitignore syntax,
+	// the default one is ".dedupignore".
+	//
+	// It must be called before Scan().
+	SetIgnoreFiles(names []string)
+
+	// Get files whose content does not match saved hashes.
+	//
+	// This function should be called after scanning files in verify mode.
+	GetCorruptedFiles() []*CorruptedFile
+
 	// Scan files
 	Scan() error
 
@@ -176,6 +341,12 @@ type fileScannerImpl struct {
 	// The key is file full path, would be lower case on Windows.
 	cacheFiles map[string]*FileAttr
 
+	// The same files as "cacheFiles", but the key is device and inode.
+	//
+	// It's used to find files that were renamed or moved
+	// since previous scanning, so their hashes could be reused.
+	cacheIds map[FileId]*FileAttr
+
 	// All files scanned this time.
 	scannedFiles map[SHA256Digest][]*FileAttr
 
@@ -189,14 +360,28 @@ type fileScannerImpl struct {
 	hashEngine   hash.Hash // SHA256 hash engine.
 	buffer       []byte    // Buffer for reading file content.
 	cacheDirty   bool      // Indicates if cache file needs to update.
+	xattrMode    int       // XATTR_MODE_???
+	root         int       // Index of the path being scanned.
+
+	// If it's not null, then files of other sizes are skipped.
+	sizeFilter map[int64]bool
+
+	verify         bool             // Verify saved hashes.
+	corruptedFiles []*CorruptedFile // Files that do not match saved hashes.
+	ignoreFiles    []string         // Names of ignore files.
+	keepHardLinks  bool             // Keep hard links of the same file.
+
+	// Devices whose file systems could not save extended attributes.
+	xattrDisabled map[uint64]bool
 }
 
 // Create a new file scanner.
 func NewFileScanner(paths []string,
-	filter Filter, updater Updater) FileScanner {
+	filter Filter, updater Updater, xattrMode int) FileScanner {
 
 	return &fileScannerImpl{
 		cacheFiles:   make(map[string]*FileAttr),
+		cacheIds:     make(map[FileId]*FileAttr),
 		scannedFiles: make(map[SHA256Digest][]*FileAttr),
 		paths:        paths,
 		filter:       filter,
@@ -204,9 +389,17 @@ func NewFileScanner(paths []string,
 		cache:        (filter.GetCacheDir() + string(os.PathSeparator) + "global.cache"),
 		hashEngine:   sha256.New(),
 		buffer:       make([]byte, 512*1024),
+		xattrMode:    xattrMode,
+		ignoreFiles:  []string{IGNORE_FILE_NAME},
+
+		xattrDisabled: make(map[uint64]bool),
 	}
 }
 
+func (me *fileScannerImpl) GetPaths() []string {
+	return me.paths
+}
+
 func (me *fileScannerImpl) GetTotalFiles() int {
 	return me.totalFiles
 }
@@ -225,11 +418,47 @@ func (me *fileScannerImpl) GetScannedFiles() map[SHA256Digest][]*FileAttr {
 
 func (me *fileScannerImpl) OnFileRemoved(removed *FileAttr) {
 	delete(me.cacheFiles, GetPathAsKey(removed.Path))
+
+	if value, found := me.cacheIds[removed.Id]; found && SamePath(value.Path, removed.Path) {
+		delete(me.cacheIds, removed.Id)
+	}
+
 	me.cacheDirty = true
 }
 
+func (me *fileScannerImpl) OnFileChanged(changed *FileAttr) {
+	me.OnFileRemoved(changed)
+
+	if me.xattrMode != XATTR_MODE_OFF {
+		RemoveXattr(changed.Path)
+	}
+}
+
+func (me *fileScannerImpl) SetSizeFilter(sizes map[int64]bool) {
+	me.sizeFilter = sizes
+}
+
+func (me *fileScannerImpl) SetVerify(verify bool) {
+	me.verify = verify
+}
+
+func (me *fileScannerImpl) SetKeepHardLinks(keep bool) {
+	me.keepHardLinks = keep
+}
+
+func (me *fileScannerImpl) SetIgnoreFiles(names []string) {
+	me.ignoreFiles = names
+}
+
+func (me *fileScannerImpl) GetCorruptedFiles() []*CorruptedFile {
+	return me.corruptedFiles
+}
+
 func (me *fileScannerImpl) Scan() error {
-	for _, path := range me.paths {
+	for i, path := range me.paths {
+		// Index of current root.
+		me.root = i
+
 		// Save old numbers.
 		oldTotalFiles := me.totalFiles
 		oldTotalFolders := me.totalFolders
@@ -253,7 +482,7 @@ func (me *fileScannerImpl) Scan() error {
 				if err := me.scanFolder(path); err != nil {
 					return err
 				}
-			} else {
+			} else if me.sizeFilter == nil || me.sizeFilter[info.Size()] {
 				me.scanFile(path, info)
 			}
 		}
@@ -266,9 +495,46 @@ func (me *fileScannerImpl) Scan() error {
 		me.updater.Log(LOG_INFO, "")
 	}
 
+	// Remove cache entries of files that no longer exist.
+	me.removeStaleCache()
+
 	return nil
 }
 
+// Remove cache entries of files that were deleted, renamed or moved.
+//
+// Only files under scanned paths are checked. A file that was found
+// while scanning has valid FileAttr.Details, so it's skipped.
+func (me *fileScannerImpl) removeStaleCache() {
+	for _, value := range me.cacheFiles {
+		if value.Details != nil {
+			continue
+		}
+
+		for _, path := range me.paths {
+			if SameOrIsChild(path, value.Path) {
+				me.removeCacheIfStale(value)
+				break
+			}
+		}
+	}
+}
+
+// Remove a cache entry if the file does not exist any more,
+// or the path now points to a different file.
+func (me *fileScannerImpl) removeCacheIfStale(file *FileAttr) {
+	if info, err := os.Lstat(file.Path); err == nil {
+		if id, _, ok := GetFileId(info); !ok || id == file.Id {
+			return
+		}
+	} else if !os.IsNotExist(err) {
+		return
+	}
+
+	me.updater.Log(LOG_TRACE, "Removing stale cache entry %v...", file.Path)
+	me.OnFileRemoved(file)
+}
+
 // Scan folder and all its sub-folders.
 func (me *fileScannerImpl) scanFolder(path string) error {
 
@@ -276,6 +542,10 @@ func (me *fileScannerImpl) scanFolder(path string) error {
 	folders := make([]string, 0, 64)
 	folders = append(folders, path)
 
+	// Ignore rules of parent folders, see ignore files.
+	parentRules := make([]*ignoreRules, 0, 64)
+	parentRules = append(parentRules, nil)
+
 	for head < tail {
 		// Check if fatal error ever happened.
 		if err := me.updater.FatalError(); err != nil {
@@ -290,6 +560,12 @@ func (me *fileScannerImpl) scanFolder(path string) error {
 			me.updater.Log(LOG_INFO, "Scanning %v...", folder)
 		}
 
+		// Rules of ignore files are inherited by sub-folders.
+		rules, invalid := readIgnoreFiles(folder, me.ignoreFiles, parentRules[head-1])
+		for _, line := range invalid {
+			me.updater.Log(LOG_WARN, "Invalid ignore pattern in %v: %v", folder, line)
+		}
+
 		// Open this folder.
 		fp, err := os.Open(folder)
 		if err != nil {
@@ -321,12 +597,27 @@ func (me *fileScannerImpl) scanFolder(path string) error {
 					continue
 				}
 
+				// Check if it's ignored by ignore files. Ignore files
+				// themselves are skipped as well, because they control
+				// what is scanned and must never be removed.
+				if (!items[i].IsDir() && me.isIgnoreFile(items[i].Name())) ||
+					rules.Match(subPath, items[i].IsDir()) {
+					me.updater.Log(LOG_TRACE, "Ignoring %v...", subPath)
+					continue
+				}
+
 				if items[i].IsDir() {
 					// Push the sub-folder path to the end.
 					folders = append(folders, subPath)
+					parentRules = append(parentRules, rules)
 					tail++
 					me.totalFolders++
 				} else if items[i].Mode().IsRegular() {
+					// Skip files of other sizes.
+					if me.sizeFilter != nil && !me.sizeFilter[items[i].Size()] {
+						continue
+					}
+
 					me.scanFile(subPath, items[i])
 				}
 			}
@@ -344,16 +635,28 @@ func (me *fileScannerImpl) scanFolder(path string) error {
 	return nil
 }
 
+// Check if it's the name of an ignore file, e.g. ".dedupignore".
+func (me *fileScannerImpl) isIgnoreFile(name string) bool {
+	for _, ignoreFile := range me.ignoreFiles {
+		if name == ignoreFile {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (me *fileScannerImpl) onFileFound(newFile *FileAttr) {
 	// Update map[SHA256]...
 	if list, ok := me.scannedFiles[newFile.SHA256]; ok {
 		for _, existing := range list {
 			// 1. Check file size here to avoid hash collision.
 			// 2. If the two paths are the same, then skip.
-			// 3. If the two paths point to the same file, then skip.
+			// 3. If the two paths point to the same file (hard links),
+			//    then skip unless hard links are kept.
 			if existing.Size != newFile.Size ||
 				SamePath(existing.Path, newFile.Path) ||
-				os.SameFile(existing.Details, newFile.Details) {
+				(!me.keepHardLinks && os.SameFile(existing.Details, newFile.Details)) {
 				return
 			}
 		}
@@ -374,34 +677,206 @@ func (me *fileScannerImpl) onFileFound(newFile *FileAttr) {
 func (me *fileScannerImpl) scanFile(
 	path string, info os.FileInfo) error {
 
-	// File path is map key.
-	key := GetPathAsKey(path)
+	// Create a new object, hash will be set later.
+	newValue := NewFileAttr(path, info)
+	newValue.Root = me.root
 
-	// If the file already exists in the map,
-	// and file size & last modification time are the same,
+	// Files are filtered by content type, see Filter.SkipContentType().
+	if me.filter.NeedContentType() {
+		newValue.MimeType = me.getContentType(newValue)
+
+		if me.filter.SkipContentType(newValue.Name, newValue.MimeType) {
+			return nil
+		}
+	}
+
+	// If extended attributes are used instead of cache file, then check
+	// if the hash saved along with the file is still valid.
+	// The attribute follows the file when it's renamed or moved.
+	if me.xattrMode == XATTR_MODE_ONLY && me.scanXattr(newValue, info) {
+		return nil
+	}
+
+	// If the file already exists in the map, and file size,
+	// last modification time, last change time and inode are the same,
 	// then skip to read file content to enhance performance.
-	if value, found := me.cacheFiles[key]; found {
-		if value.Size == info.Size() && value.ModTime == info.ModTime().UnixNano() {
-			// Set FileAttr.Details to valid value.
+	//
+	// Some tools (e.g. "rsync -t", "touch -r", restoring from backup)
+	// preserve last modification time while rewriting file content,
+	// so last change time and inode must match as well.
+	if value, found := me.cacheFiles[GetPathAsKey(path)]; found {
+		if value.Size == newValue.Size &&
+			value.ModTime == newValue.ModTime &&
+			value.ChangeTime == newValue.ChangeTime &&
+			value.Id == newValue.Id {
+			// Set FileAttr.Details to valid value,
+			// which means that the cache entry is still in use.
 			value.Details = info
 
+			// The file was found corrupted, so the saved hash does not
+			// match its content, calculate hash again, see verifyHash().
+			if value.Corrupted && !me.verify {
+				if err := me.calculateHash(newValue); err != nil {
+					return err
+				}
+
+				me.onFileFound(newValue)
+				return nil
+			}
+
+			if !me.verifyHash(newValue, value.SHA256) {
+				return nil
+			}
+
+			// The file is healthy again.
+			if value.Corrupted {
+				value.Corrupted = false
+				me.cacheDirty = true
+			}
+
+			// The new object has all latest attributes.
+			newValue.SHA256 = value.SHA256
+
+			// Save content type if it was detected this time.
+			if len(newValue.MimeType) == 0 {
+				newValue.MimeType = value.MimeType
+			} else if value.MimeType != newValue.MimeType {
+				value.MimeType = newValue.MimeType
+				me.cacheDirty = true
+			}
+
+			// Save the hash to extended attribute as well.
+			if me.saveXattr(newValue) {
+				value.ChangeTime = newValue.ChangeTime
+				me.cacheDirty = true
+			}
+
+			// Update total count and map[SHA256]...
+			me.onFileFound(newValue)
+
+			return nil
+		}
+
+		// In verify mode, content of a file whose size and last modification
+		// time are not changed should not change either, even if its last
+		// change time or inode changed (e.g. "chmod", "cp -a"), so it's
+		// compared with saved hash rather than hashed as a new file.
+		if me.verify && value.Size == newValue.Size && value.ModTime == newValue.ModTime {
+			if !me.verifyHash(newValue, value.SHA256) {
+				return nil
+			}
+
+			if len(newValue.MimeType) == 0 {
+				newValue.MimeType = value.MimeType
+			}
+
+			// Save the hash to extended attribute as well.
+			me.saveXattr(newValue)
+
+			// Replace the cache entry with latest attributes.
+			me.addCache(newValue)
+
 			// Update total count and map[SHA256]...
-			me.onFileFound(value)
+			me.onFileFound(newValue)
+
+			return nil
+		}
+	}
+
+	// If the same device & inode exists in the map,
+	// and file size & last modification time are the same,
+	// then the file was renamed or moved, reuse its hash.
+	if value := me.findCacheById(newValue); value != nil {
+		me.updater.Log(LOG_TRACE, "%v was renamed to %v.", value.Path, path)
+
+		if !me.verifyHash(newValue, value.SHA256) {
+			return nil
+		}
+
+		newValue.SHA256 = value.SHA256
+
+		if len(newValue.MimeType) == 0 {
+			newValue.MimeType = value.MimeType
+		}
+
+		// The old path is not needed any more.
+		me.removeCacheIfStale(value)
 
+		// Save the hash to extended attribute as well.
+		me.saveXattr(newValue)
+
+		// Add the new object to map.
+		me.addCache(newValue)
+
+		// Update total count and map[SHA256]...
+		me.onFileFound(newValue)
+
+		return nil
+	}
+
+	// With cache file, extended attribute is not trusted if the file
+	// is in cache, because last change time could not be saved along
+	// with it, and the cache entry (having last change time) has been
+	// checked above. Otherwise (e.g. the file was moved to another
+	// device, or cache file was removed), the attribute is used.
+	if me.xattrMode == XATTR_MODE_ON {
+		if _, found := me.cacheFiles[GetPathAsKey(path)]; !found && me.scanXattr(newValue, info) {
 			return nil
 		}
 	}
 
+	// Calculate hash.
+	if err := me.calculateHash(newValue); err != nil {
+		return err
+	}
+
+	// Save the hash to extended attribute as well.
+	me.saveXattr(newValue)
+
+	// Add the new object to map.
+	me.addCache(newValue)
+
+	// Update total count and map[SHA256]...
+	me.onFileFound(newValue)
+
+	return nil
+}
+
+// Use the hash saved in extended attribute if it's still valid,
+// see ReadXattr(). Return true if the file has been handled.
+//
+// The hash is not added to cache file, because last change time
+// could not be validated.
+func (me *fileScannerImpl) scanXattr(file *FileAttr, info os.FileInfo) bool {
+	digest, ok := ReadXattr(file.Path, info)
+	if !ok {
+		return false
+	}
+
+	me.updater.Log(LOG_TRACE, "Using hash saved in extended attribute of %v.", file.Path)
+
+	if me.verifyHash(file, digest) {
+		file.SHA256 = digest
+
+		// Update total count and map[SHA256]...
+		me.onFileFound(file)
+	}
+
+	return true
+}
+
+// Read file content and set FileAttr.SHA256.
+func (me *fileScannerImpl) calculateHash(file *FileAttr) error {
 	// Open file.
-	fp, err := os.Open(path)
+	fp, err := os.Open(file.Path)
 	if err != nil {
 		me.updater.IncreaseErrors()
-		me.updater.Log(LOG_ERROR, "Could not open file %v. Error:%v", path, err)
+		me.updater.Log(LOG_ERROR, "Could not open file %v. Error:%v", file.Path, err)
 		return err
 	}
 	defer fp.Close()
 
-	me.updater.Log(LOG_TRACE, "Calculating checksum for %v...", path)
+	me.updater.Log(LOG_TRACE, "Calculating checksum for %v...", file.Path)
 
 	// Reset hash engine
 	me.hashEngine.Reset()
@@ -416,39 +891,199 @@ func (me *fileScannerImpl) scanFile(
 		n, err := fp.Read(me.buffer)
 		if err != nil && err != io.EOF {
 			me.updater.IncreaseErrors()
-			me.updater.Log(LOG_ERROR, "Could not read file %v. Error:%v", path, err)
+			me.updater.Log(LOG_ERROR, "Could not read file %v. Error:%v", file.Path, err)
 			return err
 		}
 		me.hashEngine.Write(me.buffer[0:n])
 
+		// Content type is detected by the beginning of file.
+		if len(file.MimeType) == 0 {
+			file.MimeType = DetectContentType(me.buffer[0:n])
+		}
+
 		if err == io.EOF {
 			break
 		}
 	}
 
-	// Create a new object.
-	newValue := &FileAttr{
-		Path:    path,
-		Name:    info.Name(),
-		ModTime: info.ModTime().UnixNano(),
-		Size:    info.Size(),
-		Details: info,
+	copy(file.SHA256[:], me.hashEngine.Sum(nil))
+
+	return nil
+}
+
+// Get content type of a file from cache, or detect it by magic bytes.
+//
+// "" is returned if it could not be detected.
+func (me *fileScannerImpl) getContentType(file *FileAttr) string {
+	if value, found := me.cacheFiles[GetPathAsKey(file.Path)]; found &&
+		len(value.MimeType) > 0 &&
+		value.Size == file.Size &&
+		value.ModTime == file.ModTime &&
+		value.ChangeTime == file.ChangeTime &&
+		value.Id == file.Id {
+		return value.MimeType
 	}
-	copy(newValue.SHA256[:], me.hashEngine.Sum(nil))
 
-	// Add the new object to map.
-	me.cacheFiles[key] = newValue
+	mimeType, err := SniffContentType(file.Path)
+	if err != nil {
+		me.updater.IncreaseErrors()
+		me.updater.Log(LOG_ERROR, "Could not read file %v. Error:%v", file.Path, err)
+		return ""
+	}
 
-	// A new file was added, set dirty flag to true.
-	me.cacheDirty = true
+	me.updater.Log(LOG_TRACE, "%v is %v.", file.Path, mimeType)
+	return mimeType
+}
+
+// In verify mode, calculate hash again and compare it with saved one.
+//
+// Return true if the saved hash is correct (or it's not verify mode).
+// Otherwise, the file has been handled and caller should return.
+func (me *fileScannerImpl) verifyHash(file *FileAttr, expected SHA256Digest) bool {
+	if !me.verify {
+		return true
+	}
+
+	if err := me.calculateHash(file); err != nil {
+		return false
+	}
+
+	if file.SHA256 == expected {
+		return true
+	}
+
+	// Saved hash is kept, so the file is reported again next time
+	// until it's fixed, but it's marked as corrupted, so that other
+	// commands calculate its hash again instead of grouping it
+	// with its healthy copies.
+	me.markCorrupted(file, expected)
+
+	me.updater.Log(LOG_WARN, "%v is corrupted, expected %v but got %v.",
+		file.Path, &expected, &file.SHA256)
+	me.corruptedFiles = append(me.corruptedFiles,
+		&CorruptedFile{File: file, Expected: expected})
 
 	// Update total count and map[SHA256]...
-	me.onFileFound(newValue)
+	me.onFileFound(file)
+
+	return false
+}
+
+// Mark cache entry of a corrupted file, see FileAttr.Corrupted.
+func (me *fileScannerImpl) markCorrupted(file *FileAttr, expected SHA256Digest) {
+	marked := *file
+	marked.SHA256 = expected
+	marked.Corrupted = true
+
+	// The flag could not be saved in extended attribute,
+	// so remove the attribute instead, which updates last change time.
+	if me.xattrMode != XATTR_MODE_OFF && RemoveXattr(file.Path) == nil {
+		if info, err := os.Lstat(file.Path); err == nil {
+			if _, ctime, ok := GetFileId(info); ok {
+				marked.ChangeTime = ctime
+			}
+		}
+	}
+
+	me.addCache(&marked)
+}
+
+// Find a cache entry with the same device, inode,
+// file size and last modification time, but a different path.
+//
+// Change time is not compared, because most file systems
+// update it when a file is renamed.
+func (me *fileScannerImpl) findCacheById(file *FileAttr) *FileAttr {
+	if !file.Id.IsValid() {
+		return nil
+	}
+
+	if value, found := me.cacheIds[file.Id]; found &&
+		value.Size == file.Size && value.ModTime == file.ModTime &&
+		!value.Corrupted && !SamePath(value.Path, file.Path) {
+		return value
+	}
 
 	return nil
 }
 
+// Add a file to cache if it's new or changed.
+func (me *fileScannerImpl) addCache(file *FileAttr) {
+	// Cache file is not used at all.
+	if me.xattrMode == XATTR_MODE_ONLY {
+		return
+	}
+
+	key := GetPathAsKey(file.Path)
+
+	if value, found := me.cacheFiles[key]; found &&
+		value.Size == file.Size &&
+		value.ModTime == file.ModTime &&
+		value.SHA256 == file.SHA256 &&
+		value.ChangeTime == file.ChangeTime &&
+		value.Id == file.Id &&
+		value.Corrupted == file.Corrupted {
+		return
+	} else if found && value.Id != file.Id && me.cacheIds[value.Id] == value {
+		// The path points to a different file now.
+		delete(me.cacheIds, value.Id)
+	}
+
+	me.cacheFiles[key] = file
+
+	if file.Id.IsValid() {
+		me.cacheIds[file.Id] = file
+	}
+
+	// A new file was added, set dirty flag to true.
+	me.cacheDirty = true
+}
+
+// Save file hash to extended attribute if it's enabled.
+//
+// Errors are ignored, because extended attributes might not be
+// supported by the file system, or the file might be read-only.
+// If the file system does not support them (or it's read-only),
+// then they are not saved on the same device any more.
+//
+// Writing extended attribute updates last change time of the file,
+// so it's written only if it's changed. If it's written,
+// FileAttr.ChangeTime is updated and true is returned.
+func (me *fileScannerImpl) saveXattr(file *FileAttr) bool {
+	if me.xattrMode == XATTR_MODE_OFF || me.xattrDisabled[file.Id.Device] {
+		return false
+	}
+
+	if HasXattr(file) {
+		return false
+	}
+
+	if err := SaveXattr(file); err != nil {
+		if err == ErrXattrNotSupported {
+			me.xattrDisabled[file.Id.Device] = true
+		}
+
+		me.updater.Log(LOG_TRACE, "Could not save extended attribute for %v. Error:%v",
+			file.Path, err)
+		return false
+	}
+
+	if info, err := os.Lstat(file.Path); err == nil {
+		if _, ctime, ok := GetFileId(info); ok && ctime != file.ChangeTime {
+			file.ChangeTime = ctime
+			return true
+		}
+	}
+
+	return false
+}
+
 func (me *fileScannerImpl) ReadCache() error {
+	// Cache file is not used at all.
+	if me.xattrMode == XATTR_MODE_ONLY {
+		return nil
+	}
+
 	// Print trace log message.
 	me.updater.Log(LOG_TRACE, "Reading cache %v...", me.cache)
 
@@ -471,6 +1106,10 @@ func (me *fileScannerImpl) ReadCache() error {
 
 		if err := object.ReadCache(reader); err == nil {
 			me.cacheFiles[GetPathAsKey(object.Path)] = object
+
+			if object.Id.IsValid() {
+				me.cacheIds[object.Id] = object
+			}
 		} else if err == io.EOF {
 			break
 		} else {
@@ -482,7 +1121,7 @@ func (me *fileScannerImpl) ReadCache() error {
 }
 
 func (me *fileScannerImpl) SaveCache() error {
-	if !me.cacheDirty {
+	if !me.cacheDirty || me.xattrMode == XATTR_MODE_ONLY {
 		return nil
 	}
 
@@ -0,0 +1,46 @@
+//go:build darwin || freebsd
+
+// File deduplication
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Get device, inode and last change time of a file.
+//
+// If they are not available, then false is returned.
+func GetFileId(info os.FileInfo) (FileId, int64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return FileId{}, 0, false
+	}
+
+	return FileId{Device: uint64(stat.Dev), Inode: uint64(stat.Ino)},
+		stat.Ctimespec.Nano(), true
+}
+
+// Get owner, group and number of hard links of a file.
+//
+// If they are not available, then false is returned.
+func GetFileOwner(info os.FileInfo) (uint32, uint32, uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, 0, false
+	}
+
+	return stat.Uid, stat.Gid, uint64(stat.Nlink), true
+}
+
+// Get creation (birth) time of a file.
+//
+// If it's not available, then false is returned.
+func GetBirthTime(path string, info os.FileInfo) (int64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	return stat.Birthtimespec.Nano(), true
+}
@@ -0,0 +1,105 @@
+// File deduplication
+package main
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// Get device, inode and last change time of a file.
+//
+// If they are not available, then false is returned.
+func GetFileId(info os.FileInfo) (FileId, int64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return FileId{}, 0, false
+	}
+
+	return FileId{Device: uint64(stat.Dev), Inode: uint64(stat.Ino)},
+		stat.Ctim.Nano(), true
+}
+
+// Get owner, group and number of hard links of a file.
+//
+// If they are not available, then false is returned.
+func GetFileOwner(info os.FileInfo) (uint32, uint32, uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, 0, false
+	}
+
+	return stat.Uid, stat.Gid, uint64(stat.Nlink), true
+}
+
+// System call number of statx(), which is not defined by package syscall.
+var statxTrapMapping = map[string]uintptr{
+	"386":     383,
+	"amd64":   332,
+	"arm":     397,
+	"arm64":   291,
+	"loong64": 291,
+	"ppc64":   383,
+	"ppc64le": 383,
+	"riscv64": 291,
+	"s390x":   379,
+}
+
+const (
+	STATX_AT_FDCWD            = -100
+	STATX_AT_SYMLINK_NOFOLLOW = 0x100
+	STATX_BTIME               = 0x800
+)
+
+type statxTimestamp struct {
+	Sec      int64
+	Nsec     uint32
+	Reserved int32
+}
+
+// "struct statx", whose size is 256 bytes.
+type statxData struct {
+	Mask           uint32
+	Blksize        uint32
+	Attributes     uint64
+	Nlink          uint32
+	Uid            uint32
+	Gid            uint32
+	Mode           uint16
+	Spare0         uint16
+	Ino            uint64
+	Size           uint64
+	Blocks         uint64
+	AttributesMask uint64
+	Atime          statxTimestamp
+	Btime          statxTimestamp
+	Ctime          statxTimestamp
+	Mtime          statxTimestamp
+	Spare          [128]byte
+}
+
+// Get creation (birth) time of a file by calling statx().
+//
+// If it's not supported by kernel or file system, then false is returned.
+func GetBirthTime(path string, info os.FileInfo) (int64, bool) {
+	trap, ok := statxTrapMapping[runtime.GOARCH]
+	if !ok {
+		return 0, false
+	}
+
+	name, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return 0, false
+	}
+
+	var data statxData
+	dirfd := STATX_AT_FDCWD
+	_, _, errno := syscall.Syscall6(trap, uintptr(dirfd), uintptr(unsafe.Pointer(name)),
+		STATX_AT_SYMLINK_NOFOLLOW, STATX_BTIME, uintptr(unsafe.Pointer(&data)), 0)
+	if errno != 0 || data.Mask&STATX_BTIME == 0 {
+		return 0, false
+	}
+
+	return data.Btime.Sec*1e9 + int64(data.Btime.Nsec), true
+}
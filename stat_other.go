@@ -0,0 +1,29 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+// File deduplication
+package main
+
+import (
+	"os"
+)
+
+// Get device, inode and last change time of a file.
+//
+// If they are not available, then false is returned.
+func GetFileId(info os.FileInfo) (FileId, int64, bool) {
+	return FileId{}, 0, false
+}
+
+// Get owner, group and number of hard links of a file.
+//
+// If they are not available, then false is returned.
+func GetFileOwner(info os.FileInfo) (uint32, uint32, uint64, bool) {
+	return 0, 0, 0, false
+}
+
+// Get creation (birth) time of a file.
+//
+// If it's not available, then false is returned.
+func GetBirthTime(path string, info os.FileInfo) (int64, bool) {
+	return 0, false
+}
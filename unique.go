@@ -0,0 +1,124 @@
+// File deduplication
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+func usageUnique() {
+	fmt.Println("Usage: dedup unique [-v] [-r] [-i <TYPE>,...] [-e <TYPE>,...] [-sniff] [-x <GLOB>,...] [-xr <REGEX>] [-ix <GLOB>,...] [-ixr <REGEX>] [-gitignore] [-xattr <MODE>] <path> <other>...")
+	fmt.Println()
+	fmt.Println("List files under <path> whose content has no copy under <other>...")
+	fmt.Println()
+	fmt.Println("Options and Arguments:")
+	fmt.Println("    -r:        Reverse, list files under <other>... that have no copy under <path>.")
+	fmt.Println()
+}
+
+// Check if a path is one of roots, or a child of them.
+func isUnderPaths(roots []string, path string) bool {
+	for _, root := range roots {
+		if SameOrIsChild(root, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Command line options of "dedup unique".
+type uniqueOptions struct {
+	scanOptions
+	reverse bool
+}
+
+// Register flags of "dedup unique" to a flag set.
+func (me *uniqueOptions) addFlags(flags *flag.FlagSet) {
+	me.scanOptions.addFlags(flags)
+	flags.BoolVar(&me.reverse, "r", false, "List files under <other>... that have no copy under <path>.")
+}
+
+// "dedup unique <path> <other>..."
+func mainUnique(args []string) int {
+	var options uniqueOptions
+
+	// Parse command line options.
+	flags := flag.NewFlagSet("unique", flag.ContinueOnError)
+	flags.Usage = usageUnique
+	options.addFlags(flags)
+	if err := parseFlags(flags, "unique", args); err != nil {
+		return 1
+	}
+
+	// If argument is missing, then exit.
+	if flags.NArg() < 2 {
+		usageUnique()
+		return 1
+	}
+
+	// Convert input paths to absolute, they are used to
+	// check which side a file belongs to.
+	sources, err := getAbsUniquePaths(flags.Args()[0:1])
+	if err != nil {
+		return 1
+	}
+
+	others, err := getAbsUniquePaths(flags.Args()[1:])
+	if err != nil {
+		return 1
+	}
+
+	if options.reverse {
+		sources, others = others, sources
+	}
+
+	// Scan files.
+	scanner, updater, err := options.scan(flags.Args())
+	if err != nil {
+		return 1
+	}
+
+	// Update local cache.
+	scanner.SaveCache()
+
+	// Result variables
+	var uniqueFiles int = 0
+	var uniqueBytes int64 = 0
+
+	updater.Log(LOG_INFO, "<Unique Files>")
+
+	for _, file := range getSortedScannedFiles(scanner) {
+		// Files that are under the other side have a copy by themselves.
+		if !isUnderPaths(sources, file.Path) || isUnderPaths(others, file.Path) {
+			continue
+		}
+
+		// Check if any copy is under the other side.
+		unique := true
+		for _, item := range scanner.GetScannedFiles()[file.SHA256] {
+			// Check file size here to avoid hash collision.
+			if item.Size == file.Size && isUnderPaths(others, item.Path) {
+				unique = false
+				break
+			}
+		}
+
+		if unique {
+			updater.Log(LOG_INFO, "%v", file.Path)
+			uniqueFiles++
+			uniqueBytes += file.Size
+		}
+	}
+
+	updater.Log(LOG_INFO, "")
+	logScanSummary(scanner, updater)
+	updater.Log(LOG_INFO, "Unique Files:     %v", uniqueFiles)
+	updater.Log(LOG_INFO, "Unique Size:      %.3f MB", float64(uniqueBytes)/(1024*1024))
+
+	if updater.Errors() > 0 {
+		updater.Log(LOG_INFO, "Errors:           %v", updater.Errors())
+	}
+
+	return 0
+}
@@ -0,0 +1,159 @@
+// File deduplication
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func usageVerify() {
+	fmt.Println("Usage: dedup verify [-v] [-heal] [-i <TYPE>,...] [-e <TYPE>,...] [-sniff] [-x <GLOB>,...] [-xr <REGEX>] [-ix <GLOB>,...] [-ixr <REGEX>] [-gitignore] [-xattr <MODE>] <path>...")
+	fmt.Println()
+	fmt.Println("Calculate hashes of files whose size and modification time are not")
+	fmt.Println("changed again, and report files")
+	fmt.Println("whose content does not match saved hashes (silent corruption).")
+	fmt.Println()
+	fmt.Println("Options and Arguments:")
+	fmt.Println("    -heal:     Restore corrupted files from their healthy copies.")
+	fmt.Println()
+}
+
+// Find a healthy copy of a corrupted file.
+func findHealthyCopy(scanner FileScanner, corrupted *CorruptedFile) *FileAttr {
+	for _, item := range scanner.GetScannedFiles()[corrupted.Expected] {
+		// Check file size here to avoid hash collision.
+		if item.Size == corrupted.File.Size && !SamePath(item.Path, corrupted.File.Path) {
+			return item
+		}
+	}
+
+	return nil
+}
+
+// Replace a corrupted file with a healthy copy.
+//
+// The healthy copy is copied to a temporary file first,
+// which is renamed to the corrupted file at last.
+func healFile(corrupted, healthy *FileAttr) error {
+	temp := GetUnusedPath(filepath.Join(
+		filepath.Dir(corrupted.Path), "."+corrupted.Name+".dedup"), nil)
+
+	if err := CopyFile(healthy.Path, temp); err != nil {
+		return err
+	}
+
+	// Keep last modification time of the corrupted file.
+	if err := os.Chtimes(temp, time.Now(), time.Unix(0, corrupted.ModTime)); err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	if err := os.Rename(temp, corrupted.Path); err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	return nil
+}
+
+// Command line options of "dedup verify".
+type verifyOptions struct {
+	scanOptions
+	heal bool
+}
+
+// Register flags of "dedup verify" to a flag set.
+func (me *verifyOptions) addFlags(flags *flag.FlagSet) {
+	me.scanOptions.addFlags(flags)
+	flags.BoolVar(&me.heal, "heal", false, "Restore corrupted files from their healthy copies.")
+}
+
+// "dedup verify <path>..."
+func mainVerify(args []string) int {
+	var options verifyOptions
+
+	// Parse command line options.
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.Usage = usageVerify
+	options.addFlags(flags)
+	if err := parseFlags(flags, "verify", args); err != nil {
+		return 1
+	}
+
+	// If argument is missing, then exit.
+	if flags.NArg() == 0 {
+		usageVerify()
+		return 1
+	}
+
+	scanner, updater, err := options.newScanner(flags.Args())
+	if err != nil {
+		return 1
+	}
+
+	scanner.SetVerify(true)
+
+	if err := scanner.Scan(); err != nil {
+		return 1
+	}
+
+	// Result variables
+	var healedFiles int = 0
+
+	corruptedFiles := scanner.GetCorruptedFiles()
+	if len(corruptedFiles) > 0 {
+		updater.Log(LOG_INFO, "<Corrupted Files>")
+	}
+
+	for _, corrupted := range corruptedFiles {
+		healthy := findHealthyCopy(scanner, corrupted)
+
+		if healthy == nil {
+			updater.Log(LOG_INFO, "%v (no healthy copy)", corrupted.File.Path)
+			continue
+		}
+
+		if !options.heal {
+			updater.Log(LOG_INFO, "%v (healthy copy: %v)", corrupted.File.Path, healthy.Path)
+			continue
+		}
+
+		if err := healFile(corrupted.File, healthy); err != nil {
+			updater.IncreaseErrors()
+			updater.Log(LOG_ERROR, "Could not restore %v from %v (%v).",
+				corrupted.File.Path, healthy.Path, err)
+			continue
+		}
+
+		updater.Log(LOG_INFO, "%v was restored from %v.", corrupted.File.Path, healthy.Path)
+		healedFiles++
+	}
+
+	if len(corruptedFiles) > 0 {
+		updater.Log(LOG_INFO, "")
+	}
+
+	// Update local cache.
+	scanner.SaveCache()
+
+	logScanSummary(scanner, updater)
+	updater.Log(LOG_INFO, "Corrupted Files:  %v", len(corruptedFiles))
+
+	if options.heal {
+		updater.Log(LOG_INFO, "Restored Files:   %v", healedFiles)
+	}
+
+	if updater.Errors() > 0 {
+		updater.Log(LOG_INFO, "Errors:           %v", updater.Errors())
+	}
+
+	// Corrupted files are not fixed.
+	if len(corruptedFiles) > healedFiles {
+		return 1
+	}
+
+	return 0
+}
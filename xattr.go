@@ -0,0 +1,124 @@
+// File deduplication
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Do not read or write extended attributes.
+	XATTR_MODE_OFF = iota
+
+	// Use extended attributes in addition to cache file.
+	XATTR_MODE_ON
+
+	// Use extended attributes instead of cache file.
+	XATTR_MODE_ONLY
+)
+
+// Name of the extended attribute holding file hash.
+//
+// Value format is "<mod time>|<size>|<inode>|<sha256>".
+const XATTR_NAME_SHA256 = "user.dedup.sha256"
+
+// Xattr mode mapping table.
+var xattrModeMapping = map[string]int{
+	"":     XATTR_MODE_OFF,
+	"off":  XATTR_MODE_OFF,
+	"on":   XATTR_MODE_ON,
+	"only": XATTR_MODE_ONLY,
+}
+
+// Convert "-xattr <MODE>" argument to XATTR_MODE_???.
+func ParseXattrMode(mode string) (int, error) {
+	if value, ok := xattrModeMapping[strings.ToLower(mode)]; ok {
+		return value, nil
+	}
+
+	return XATTR_MODE_OFF, ErrInvalidXattrMode
+}
+
+// Read file hash saved in extended attribute.
+//
+// The hash is returned only if file size, last modification time
+// and inode saved along with it still match the file. If extended
+// attributes are not supported, then false is returned.
+//
+// Last change time could not be saved, because writing extended
+// attribute updates it. Inode is kept when a file is renamed, but it's
+// changed when the file is restored from backup or rewritten by
+// a new copy.
+//
+// Content rewritten in place with the same size, last modification time
+// and inode could not be detected, so with cache file ("-xattr on"),
+// the hash is used only if the file is not in cache.
+func ReadXattr(path string, info os.FileInfo) (SHA256Digest, bool) {
+	var digest SHA256Digest
+
+	data, err := getXattr(path, XATTR_NAME_SHA256)
+	if err != nil {
+		return digest, false
+	}
+
+	fields := strings.Split(string(data), "|")
+	if len(fields) != 4 {
+		return digest, false
+	}
+
+	// Mod time.
+	if number, err := strconv.ParseInt(fields[0], 10, 64); err != nil ||
+		number != info.ModTime().UnixNano() {
+		return digest, false
+	}
+
+	// Size.
+	if number, err := strconv.ParseInt(fields[1], 10, 64); err != nil ||
+		number != info.Size() {
+		return digest, false
+	}
+
+	// Inode.
+	id, _, _ := GetFileId(info)
+	if number, err := strconv.ParseUint(fields[2], 10, 64); err != nil ||
+		number != id.Inode {
+		return digest, false
+	}
+
+	// SHA256 Hash.
+	if value, err := hex.DecodeString(fields[3]); err != nil ||
+		len(value) != sha256.Size {
+		return digest, false
+	} else {
+		copy(digest[:], value)
+	}
+
+	return digest, true
+}
+
+// Get value of extended attribute of a file, see XATTR_NAME_SHA256.
+func formatXattr(file *FileAttr) string {
+	return fmt.Sprintf("%v|%v|%v|%v",
+		file.ModTime, file.Size, file.Id.Inode, &file.SHA256)
+}
+
+// Check if extended attribute has been saved with the same
+// last modification time, size, inode and hash as the file.
+func HasXattr(file *FileAttr) bool {
+	data, err := getXattr(file.Path, XATTR_NAME_SHA256)
+	return err == nil && string(data) == formatXattr(file)
+}
+
+// Save file hash to extended attribute.
+func SaveXattr(file *FileAttr) error {
+	return setXattr(file.Path, XATTR_NAME_SHA256, []byte(formatXattr(file)))
+}
+
+// Remove file hash saved in extended attribute.
+func RemoveXattr(path string) error {
+	return removeXattr(path, XATTR_NAME_SHA256)
+}
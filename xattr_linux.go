@@ -0,0 +1,42 @@
+// File deduplication
+package main
+
+import (
+	"syscall"
+)
+
+func getXattr(path, name string) ([]byte, error) {
+	buffer := make([]byte, 256)
+
+	for {
+		size, err := syscall.Getxattr(path, name, buffer)
+		if err == syscall.ERANGE {
+			// Buffer is too small, query real size and try again.
+			if size, err = syscall.Getxattr(path, name, nil); err != nil {
+				return nil, err
+			}
+
+			buffer = make([]byte, size)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		return buffer[0:size], nil
+	}
+}
+
+// ErrXattrNotSupported is returned if extended attributes
+// could not be saved on the file system at all.
+func setXattr(path, name string, value []byte) error {
+	err := syscall.Setxattr(path, name, value, 0)
+	if err == syscall.ENOTSUP || err == syscall.EROFS {
+		return ErrXattrNotSupported
+	}
+
+	return err
+}
+
+func removeXattr(path, name string) error {
+	return syscall.Removexattr(path, name)
+}
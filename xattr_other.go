@@ -0,0 +1,16 @@
+//go:build !linux
+
+// File deduplication
+package main
+
+func getXattr(path, name string) ([]byte, error) {
+	return nil, ErrXattrNotSupported
+}
+
+func setXattr(path, name string, value []byte) error {
+	return ErrXattrNotSupported
+}
+
+func removeXattr(path, name string) error {
+	return ErrXattrNotSupported
+}